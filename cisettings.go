@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Values of the auto-cancel pending pipelines setting.
+var autoCancelSettings = []string{"enabled", "disabled"}
+
+// Limits of the job timeout, in seconds, as set by Gitlab: 10 minutes and
+// 1 month.
+const (
+	minBuildTimeout = 600
+	maxBuildTimeout = 2592000
+)
+
+// CISettings is the content of CI settings file, a subset of the CI/CD
+// settings of a project. A setting missing in the file is left unchanged.
+type CISettings struct {
+	CIConfigPath               *string  `json:"ci_config_path"`
+	BuildTimeout               *int     `json:"build_timeout"`
+	AutoCancelPendingPipelines *string  `json:"auto_cancel_pending_pipelines"`
+	JobTokenScopeEnabled       *bool    `json:"job_token_scope_enabled"`
+	JobTokenAllowlist          []string `json:"job_token_allowlist"`
+}
+
+// Validate checks the values of the settings which are given.
+func (settings CISettings) Validate() error {
+	if settings.BuildTimeout != nil && (*settings.BuildTimeout < minBuildTimeout || *settings.BuildTimeout > maxBuildTimeout) {
+		return fmt.Errorf("build timeout %d is not allowed (must be between %d and %d seconds)", *settings.BuildTimeout, minBuildTimeout, maxBuildTimeout)
+	}
+	if settings.AutoCancelPendingPipelines != nil && !slices.Contains(autoCancelSettings, *settings.AutoCancelPendingPipelines) {
+		return fmt.Errorf("auto-cancel pending pipelines %s is not allowed (must be one of %v)", *settings.AutoCancelPendingPipelines, autoCancelSettings)
+	}
+	seen := make(map[string]bool)
+	for _, project := range settings.JobTokenAllowlist {
+		if project == "" {
+			return errors.New("job token allowlist has an empty project")
+		}
+		if seen[strings.ToLower(project)] {
+			return fmt.Errorf("project %s is defined twice in job token allowlist", project)
+		}
+		seen[strings.ToLower(project)] = true
+	}
+	return nil
+}
+
+// CISettingChange is a setting whose value differs between CI settings file
+// and Gitlab.
+type CISettingChange struct {
+	Name string
+	From any
+	To   any
+}
+
+// GitlabCIProject is the part of a project, as returned by Gitlab API, which
+// holds the CI settings.
+type GitlabCIProject struct {
+	Id                         int     `json:"id"`
+	PathWithNamespace          string  `json:"path_with_namespace"`
+	CIConfigPath               *string `json:"ci_config_path"`
+	BuildTimeout               int     `json:"build_timeout"`
+	AutoCancelPendingPipelines string  `json:"auto_cancel_pending_pipelines"`
+}
+
+// JobTokenScope is the job token access setting of a project as returned by
+// Gitlab API.
+type JobTokenScope struct {
+	InboundEnabled bool `json:"inbound_enabled"`
+}
+
+// ImportCISettingsFile reads a CI settings file and validates it.
+func ImportCISettingsFile(filename string) (CISettings, error) {
+	var data CISettings
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return data, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	err = data.Validate()
+	if err != nil {
+		return data, fmt.Errorf("invalid CI settings in %s: %w", filename, err)
+	}
+	return data, nil
+}
+
+// ExportCISettingsFile writes CI settings to filename, with a sorted job
+// token allowlist.
+func ExportCISettingsFile(filename string, data CISettings) error {
+	data.JobTokenAllowlist = append([]string{}, data.JobTokenAllowlist...)
+	slices.Sort(data.JobTokenAllowlist)
+	return writeJSONFile(filename, data, 0644)
+}
+
+// CompareCISettings returns the settings of CI settings file which differ
+// from the current ones, and the projects to add to and to remove from the
+// job token allowlist. The allowlist is not compared when the file has none,
+// and its paths are compared case-insensitively, as Gitlab paths are.
+func CompareCISettings(data CISettings, current CISettings) ([]CISettingChange, []string, []string) {
+	var changes []CISettingChange
+	if data.CIConfigPath != nil && *data.CIConfigPath != *current.CIConfigPath {
+		changes = append(changes, CISettingChange{"ci_config_path", *current.CIConfigPath, *data.CIConfigPath})
+	}
+	if data.BuildTimeout != nil && *data.BuildTimeout != *current.BuildTimeout {
+		changes = append(changes, CISettingChange{"build_timeout", *current.BuildTimeout, *data.BuildTimeout})
+	}
+	if data.AutoCancelPendingPipelines != nil && *data.AutoCancelPendingPipelines != *current.AutoCancelPendingPipelines {
+		changes = append(changes, CISettingChange{"auto_cancel_pending_pipelines", *current.AutoCancelPendingPipelines, *data.AutoCancelPendingPipelines})
+	}
+	if data.JobTokenScopeEnabled != nil && *data.JobTokenScopeEnabled != *current.JobTokenScopeEnabled {
+		changes = append(changes, CISettingChange{"job_token_scope_enabled", *current.JobTokenScopeEnabled, *data.JobTokenScopeEnabled})
+	}
+	if data.JobTokenAllowlist == nil {
+		return changes, nil, nil
+	}
+	var toAdd, toDelete []string
+	for _, project := range data.JobTokenAllowlist {
+		if !containsPath(current.JobTokenAllowlist, project) {
+			toAdd = append(toAdd, project)
+		}
+	}
+	for _, project := range current.JobTokenAllowlist {
+		if !containsPath(data.JobTokenAllowlist, project) {
+			toDelete = append(toDelete, project)
+		}
+	}
+	return changes, toAdd, toDelete
+}
+
+// containsPath tells whether paths holds path, whatever its case.
+func containsPath(paths []string, path string) bool {
+	return slices.ContainsFunc(paths, func(item string) bool {
+		return strings.EqualFold(item, path)
+	})
+}
+
+func projectPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId)
+}
+
+// getCISettings returns the CI settings of the project, and the ids of the
+// projects of its job token allowlist by lower case path. The project itself,
+// which Gitlab always allows, is not part of the allowlist.
+func (glcli *GLCli) getCISettings() (CISettings, map[string]int) {
+	var project GitlabCIProject
+	var scope JobTokenScope
+	var allowlist []GitlabCIProject
+	path := projectPath(glcli.ProjectId)
+	err := glcli.client.Request(http.MethodGet, path, nil, &project)
+	if err == nil {
+		err = glcli.client.Request(http.MethodGet, path+"/job_token_scope", nil, &scope)
+	}
+	if err == nil {
+		err = glcli.client.GetAll(path+"/job_token_scope/allowlist", &allowlist)
+	}
+	if err != nil {
+		log.Fatalf("Cannot fetch CI settings from gitlab: %s", err)
+	}
+	configPath := ""
+	if project.CIConfigPath != nil {
+		configPath = *project.CIConfigPath
+	}
+	settings := CISettings{
+		CIConfigPath:               &configPath,
+		BuildTimeout:               &project.BuildTimeout,
+		AutoCancelPendingPipelines: &project.AutoCancelPendingPipelines,
+		JobTokenScopeEnabled:       &scope.InboundEnabled,
+		JobTokenAllowlist:          []string{},
+	}
+	ids := make(map[string]int)
+	for _, item := range allowlist {
+		if item.Id == project.Id {
+			continue
+		}
+		settings.JobTokenAllowlist = append(settings.JobTokenAllowlist, item.PathWithNamespace)
+		ids[strings.ToLower(item.PathWithNamespace)] = item.Id
+	}
+	return settings, ids
+}
+
+// exportCISettings writes the CI settings of the project in filename.
+func (glcli *GLCli) exportCISettings(filename string) {
+	settings, _ := glcli.getCISettings()
+	err := ExportCISettingsFile(filename, settings)
+	if err != nil {
+		log.Fatalf("Cannot export CI settings to %s: %s", filename, err)
+	}
+}
+
+// syncCISettings applies the CI settings file on the project. Projects are
+// only removed from the job token allowlist in delete mode. Allowlist changes
+// are counted apart from setting changes.
+func (glcli *GLCli) syncCISettings(filename string) {
+	data, err := ImportCISettingsFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import CI settings file: %s", err)
+	}
+	current, ids := glcli.getCISettings()
+	changes, toAdd, toDelete := CompareCISettings(data, current)
+	glcli.summary.CISettings.count(0, len(changes), 0, glcli.Config.DeleteMode)
+	glcli.summary.JobTokenAllowlist.count(len(toAdd), 0, len(toDelete), glcli.Config.DeleteMode)
+	path := projectPath(glcli.ProjectId)
+	body := make(map[string]any)
+	for _, change := range changes {
+		log.Printf("Setting %s should be changed from %v to %v", change.Name, change.From, change.To)
+		if change.Name != "job_token_scope_enabled" {
+			body[change.Name] = change.To
+		}
+	}
+	if !glcli.Config.DryrunMode && len(body) > 0 {
+		err = glcli.client.Request(http.MethodPut, path, body, nil)
+		if err != nil {
+			log.Fatalf("Cannot update CI settings: %s", err)
+		}
+	}
+	if data.JobTokenScopeEnabled != nil && *data.JobTokenScopeEnabled != *current.JobTokenScopeEnabled && !glcli.Config.DryrunMode {
+		err = glcli.client.Request(http.MethodPatch, path+"/job_token_scope", map[string]bool{"enabled": *data.JobTokenScopeEnabled}, nil)
+		if err != nil {
+			log.Fatalf("Cannot update job token scope: %s", err)
+		}
+	}
+	if len(changes) == 0 {
+		log.Print("No CI setting to update")
+	}
+	for _, project := range toAdd {
+		log.Printf("Project %s should be added to job token allowlist", project)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		var target GitlabCIProject
+		err = glcli.client.Request(http.MethodGet, projectPath(project), nil, &target)
+		if err == nil {
+			err = glcli.client.Request(http.MethodPost, path+"/job_token_scope/allowlist", map[string]int{"target_project_id": target.Id}, nil)
+		}
+		if err != nil {
+			log.Fatalf("Cannot add project %s to job token allowlist: %s", project, err)
+		}
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, project := range toDelete {
+			err = glcli.client.Request(http.MethodDelete, path+"/job_token_scope/allowlist/"+strconv.Itoa(ids[strings.ToLower(project)]), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot remove project %s from job token allowlist: %s", project, err)
+			}
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d project(s) may be removed from job token allowlist, but delete flag in command line is not set", len(toDelete))
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportCISettingsFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		`{"ci_config_path": ".gitlab/ci.yml", "build_timeout": 3600, "auto_cancel_pending_pipelines": "enabled", "job_token_scope_enabled": true, "job_token_allowlist": ["infra/deployer"]}`: true,
+		`{"build_timeout": 60}`:                                         false,
+		`{"auto_cancel_pending_pipelines": "always"}`:                   false,
+		`{"job_token_allowlist": ["infra/deployer", "infra/deployer"]}`: false,
+		`{"ci_config_path": ""}`:                                        true,
+	}
+	for content, valid := range tests {
+		filename := filepath.Join(dir, "ci-settings.json")
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ImportCISettingsFile(filename)
+		if (err == nil) != valid {
+			t.Errorf(`TestImportCISettingsFile(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+}
+
+func TestCompareCISettings(t *testing.T) {
+	configPath := ""
+	timeout := 3600
+	autoCancel := "enabled"
+	enabled := true
+	current := CISettings{
+		CIConfigPath:               &configPath,
+		BuildTimeout:               &timeout,
+		AutoCancelPendingPipelines: &autoCancel,
+		JobTokenScopeEnabled:       &enabled,
+		JobTokenAllowlist:          []string{"infra/deployer", "infra/legacy"},
+	}
+
+	changes, toAdd, toDelete := CompareCISettings(CISettings{}, current)
+	if len(changes) != 0 || toAdd != nil || toDelete != nil {
+		t.Errorf(`TestCompareCISettings(empty file) = %v %v %v, want no change`, changes, toAdd, toDelete)
+	}
+
+	newPath := ".gitlab/ci.yml"
+	disabled := "disabled"
+	data := CISettings{
+		CIConfigPath:               &newPath,
+		BuildTimeout:               &timeout,
+		AutoCancelPendingPipelines: &disabled,
+		JobTokenAllowlist:          []string{"Infra/Deployer", "web/e2e"},
+	}
+	changes, toAdd, toDelete = CompareCISettings(data, current)
+	if len(changes) != 2 || changes[0].Name != "ci_config_path" || changes[1].Name != "auto_cancel_pending_pipelines" {
+		t.Errorf(`TestCompareCISettings(changes) = %v, want ci_config_path and auto_cancel_pending_pipelines`, changes)
+	}
+	if len(toAdd) != 1 || toAdd[0] != "web/e2e" {
+		t.Errorf(`TestCompareCISettings(allowlist to add) = %v, want only web/e2e`, toAdd)
+	}
+	if len(toDelete) != 1 || toDelete[0] != "infra/legacy" {
+		t.Errorf(`TestCompareCISettings(allowlist to delete) = %v, want only infra/legacy`, toDelete)
+	}
+}
+
+func TestGLCliSyncCISettings(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51":                           `{"id": 51, "path_with_namespace": "web/app", "ci_config_path": null, "build_timeout": 3600, "auto_cancel_pending_pipelines": "enabled"}`,
+		"GET /api/v4/projects/51/job_token_scope":           `{"inbound_enabled": false}`,
+		"GET /api/v4/projects/51/job_token_scope/allowlist": `[{"id": 51, "path_with_namespace": "web/app"}, {"id": 60, "path_with_namespace": "infra/old"}]`,
+		"GET /api/v4/projects/infra/tools":                  `{"id": 70, "path_with_namespace": "infra/tools"}`,
+	})
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "ci-settings.json")
+	err := os.WriteFile(filename, []byte(`{"ci_config_path": "ci/main.yml", "build_timeout": 7200, "job_token_scope_enabled": true, "job_token_allowlist": ["infra/tools"]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.syncCISettings(filename)
+	rec.expectWrites(t, "TestGLCliSyncCISettings(dry run requests)", nil)
+	if glcli.summary.CISettings != (ChangeCount{Update: 3}) || glcli.summary.JobTokenAllowlist != (ChangeCount{Add: 1, Delete: 1}) {
+		t.Errorf(`TestGLCliSyncCISettings(summary) = %s and %s, want %s and %s`, glcli.summary.CISettings, glcli.summary.JobTokenAllowlist, ChangeCount{Update: 3}, ChangeCount{Add: 1, Delete: 1})
+	}
+
+	glcli.Config.DryrunMode = false
+	glcli.syncCISettings(filename)
+	bodies := rec.bodies
+	rec.expectWrites(t, "TestGLCliSyncCISettings(requests)", []string{
+		"DELETE /api/v4/projects/51/job_token_scope/allowlist/60",
+		"PATCH /api/v4/projects/51/job_token_scope",
+		"POST /api/v4/projects/51/job_token_scope/allowlist",
+		"PUT /api/v4/projects/51",
+	})
+	update := bodies["PUT /api/v4/projects/51"]
+	if len(update) != 2 || update["build_timeout"] != float64(7200) || update["ci_config_path"] != "ci/main.yml" {
+		t.Errorf(`TestGLCliSyncCISettings(settings update) = %v, want build_timeout and ci_config_path only`, update)
+	}
+	if bodies["PATCH /api/v4/projects/51/job_token_scope"]["enabled"] != true {
+		t.Errorf(`TestGLCliSyncCISettings(job token scope) = %v, want enabled`, bodies["PATCH /api/v4/projects/51/job_token_scope"])
+	}
+	if bodies["POST /api/v4/projects/51/job_token_scope/allowlist"]["target_project_id"] != float64(70) {
+		t.Errorf(`TestGLCliSyncCISettings(allowlist) = %v, want project 70`, bodies["POST /api/v4/projects/51/job_token_scope/allowlist"])
+	}
+
+	glcli.Config.DeleteMode = false
+	glcli.syncCISettings(filename)
+	for _, request := range rec.writes() {
+		if strings.HasPrefix(request, http.MethodDelete) {
+			t.Errorf(`TestGLCliSyncCISettings(request without delete mode) = %s, want no removal`, request)
+		}
+	}
+
+	exported := filepath.Join(dir, "exported.json")
+	glcli.exportCISettings(exported)
+	data, err := ImportCISettingsFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *data.BuildTimeout != 3600 || *data.CIConfigPath != "" || len(data.JobTokenAllowlist) != 1 || data.JobTokenAllowlist[0] != "infra/old" {
+		t.Errorf(`TestGLCliSyncCISettings(exported) = %v, want the Gitlab settings without the project itself in allowlist`, data)
+	}
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatJSON   = "json"
+	formatYAML   = "yaml"
+	formatCSV    = "csv"
+	formatDotenv = "dotenv"
+)
+
+// fileModel describes the fields of a file model in the order they are
+// written, with the value taken by fields missing in a source format.
+type fileModel struct {
+	Name     string
+	Fields   []string
+	Bools    []string
+	Numbers  []string
+	Objects  []string
+	Defaults map[string]any
+	Id       func(entry map[string]any) string
+}
+
+var varsModel = fileModel{
+	Name:    "vars",
+	Fields:  []string{"key", "value", "description", "environment_scope", "raw", "hidden", "protected", "masked", "variable_type", "value_from_file", "value_ref"},
+	Bools:   []string{"raw", "hidden", "protected", "masked"},
+	Numbers: []string{},
+	Objects: []string{},
+	Defaults: map[string]any{
+		"environment_scope": "*",
+		"raw":               true,
+		"variable_type":     varTypeEnv,
+	},
+	Id: func(entry map[string]any) string {
+		return fmt.Sprintf("%v (%v)", entry["key"], entry["environment_scope"])
+	},
+}
+
+var envsModel = fileModel{
+	Name:     "envs",
+	Fields:   []string{"id", "name", "state", "external_url", "description", "tier", "auto_stop_setting", "protection"},
+	Bools:    []string{},
+	Numbers:  []string{"id"},
+	Objects:  []string{"protection"},
+	Defaults: map[string]any{},
+	Id: func(entry map[string]any) string {
+		return fmt.Sprintf("%v", entry["name"])
+	},
+}
+
+// formatFields returns the fields of the model which can be written in format.
+func (model fileModel) formatFields(format string) []string {
+	if format == formatDotenv {
+		return []string{"key", "value"}
+	}
+	if format == formatCSV {
+		// Nested objects have no CSV representation
+		var fields []string
+		for _, field := range model.Fields {
+			if !slices.Contains(model.Objects, field) {
+				fields = append(fields, field)
+			}
+		}
+		return fields
+	}
+	return model.Fields
+}
+
+func (model fileModel) isBool(field string) bool {
+	for _, item := range model.Bools {
+		if item == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (model fileModel) isNumber(field string) bool {
+	for _, item := range model.Numbers {
+		if item == field {
+			return true
+		}
+	}
+	return false
+}
+
+// isDefault tells if value is the value a field takes when it is missing.
+func (model fileModel) isDefault(field string, value any) bool {
+	if value == nil {
+		return true
+	}
+	if def, found := model.Defaults[field]; found {
+		return value == def
+	}
+	switch typed := value.(type) {
+	case string:
+		return typed == ""
+	case bool:
+		return !typed
+	case float64:
+		return typed == 0
+	}
+	return false
+}
+
+// DetectFormat returns the format of a file from its extension.
+func DetectFormat(filename string) (string, error) {
+	base := strings.ToLower(filepath.Base(filename))
+	switch filepath.Ext(base) {
+	case ".json":
+		return formatJSON, nil
+	case ".yaml", ".yml":
+		return formatYAML, nil
+	case ".csv":
+		return formatCSV, nil
+	case ".env":
+		return formatDotenv, nil
+	}
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return formatDotenv, nil
+	}
+	return "", fmt.Errorf("cannot detect format of %s (supported extensions: .json, .yaml, .yml, .csv, .env)", filename)
+}
+
+// yamlToJSON converts a YAML document to JSON.
+func yamlToJSON(content []byte) ([]byte, error) {
+	var data any
+	err := yaml.Unmarshal(content, &data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// jsonToYAML converts a JSON document to a block style YAML document, keeping
+// the order of object keys.
+func jsonToYAML(content []byte) ([]byte, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(content, &node)
+	if err != nil {
+		return nil, err
+	}
+	var setBlockStyle func(node *yaml.Node)
+	setBlockStyle = func(node *yaml.Node) {
+		node.Style &^= yaml.FlowStyle
+		if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+			node.Style &^= yaml.DoubleQuotedStyle
+		}
+		for _, child := range node.Content {
+			setBlockStyle(child)
+		}
+	}
+	setBlockStyle(&node)
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&node)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// detectModel returns the model of entries: vars have a key and envs a name.
+func detectModel(entries []map[string]any) (fileModel, error) {
+	if len(entries) == 0 {
+		return fileModel{}, errors.New("cannot detect the content type of an empty file")
+	}
+	if _, found := entries[0]["key"]; found {
+		return varsModel, nil
+	}
+	if _, found := entries[0]["name"]; found {
+		return envsModel, nil
+	}
+	return fileModel{}, errors.New("cannot detect the content type (entries have neither key nor name)")
+}
+
+func readCSV(content []byte, model *fileModel) ([]map[string]any, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	entries := []map[string]any{}
+	if len(records) == 0 {
+		return entries, nil
+	}
+	header := records[0]
+	if model.Name == "" {
+		detected, err := detectModel([]map[string]any{csvHeaderEntry(header)})
+		if err != nil {
+			return nil, err
+		}
+		*model = detected
+	}
+	for line, record := range records[1:] {
+		entry := make(map[string]any)
+		for idx, field := range header {
+			value := record[idx]
+			switch {
+			case value == "" && !model.isBool(field):
+				entry[field] = nil
+			case model.isBool(field):
+				if value == "" {
+					entry[field] = false
+					continue
+				}
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid boolean %s for %s", line+2, value, field)
+				}
+				entry[field] = parsed
+			case model.isNumber(field):
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid number %s for %s", line+2, value, field)
+				}
+				entry[field] = parsed
+			default:
+				entry[field] = value
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func csvHeaderEntry(header []string) map[string]any {
+	entry := make(map[string]any)
+	for _, field := range header {
+		entry[field] = nil
+	}
+	return entry
+}
+
+var dotenvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func readDotenv(content []byte) ([]map[string]any, error) {
+	entries := []map[string]any{}
+	for idx, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !dotenvKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid declaration", idx+1)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", idx+1)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := unquoteDotenv(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", idx+1, err)
+			}
+			value = unquoted
+		default:
+			if pos := strings.Index(value, " #"); pos >= 0 {
+				value = strings.TrimSpace(value[:pos])
+			}
+		}
+		entries = append(entries, map[string]any{"key": key, "value": value})
+	}
+	return entries, nil
+}
+
+func unquoteDotenv(value string) (string, error) {
+	var builder strings.Builder
+	for idx := 1; idx < len(value); idx++ {
+		char := value[idx]
+		switch {
+		case char == '"':
+			return builder.String(), nil
+		case char == '\\' && idx+1 < len(value):
+			idx++
+			switch value[idx] {
+			case 'n':
+				builder.WriteByte('\n')
+			case 'r':
+				builder.WriteByte('\r')
+			case 't':
+				builder.WriteByte('\t')
+			default:
+				builder.WriteByte(value[idx])
+			}
+		default:
+			builder.WriteByte(char)
+		}
+	}
+	return "", errors.New("unterminated quoted value")
+}
+
+var dotenvPlainRegexp = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+func quoteDotenv(value string) string {
+	if dotenvPlainRegexp.MatchString(value) {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// ReadConvertFile reads entries of a var or env file in any supported
+// format. The model is detected from the content when it is empty.
+func ReadConvertFile(filename string, format string, model *fileModel) ([]map[string]any, error) {
+	var entries []map[string]any
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case formatJSON, formatYAML:
+		if format == formatYAML {
+			content, err = yamlToJSON(content)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+			}
+		}
+		err = json.Unmarshal(content, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+		if model.Name == "" {
+			*model, err = detectModel(entries)
+		}
+	case formatCSV:
+		entries, err = readCSV(content, model)
+	case formatDotenv:
+		entries, err = readDotenv(content)
+		if model.Name == "" {
+			*model = varsModel
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", filename, err)
+	}
+	if format == formatDotenv && model.Name != varsModel.Name {
+		return nil, fmt.Errorf("%s format only supports vars", format)
+	}
+	for _, entry := range entries {
+		for field, value := range model.Defaults {
+			if _, found := entry[field]; !found {
+				entry[field] = value
+			}
+		}
+	}
+	return normalizeEntries(entries, model)
+}
+
+// normalizeEntries validates entries against the model by decoding them in
+// the glcli data types, and returns them with all fields of the model.
+func normalizeEntries(entries []map[string]any, model *fileModel) ([]map[string]any, error) {
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	switch model.Name {
+	case varsModel.Name:
+		var data []VarFileData
+		err = json.Unmarshal(content, &data)
+		if err == nil {
+			sortVarFileData(data)
+			content, err = json.Marshal(data)
+		}
+	case envsModel.Name:
+		var data []EnvFileData
+		err = json.Unmarshal(content, &data)
+		if err == nil {
+			sortEnvData(data)
+			content, err = json.Marshal(data)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var normalized []map[string]any
+	err = json.Unmarshal(content, &normalized)
+	if err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// LostFields returns a message for each field, or entry, of entries which
+// cannot be written in format.
+func LostFields(entries []map[string]any, format string, model fileModel) []string {
+	var messages []string
+	supported := make(map[string]bool)
+	for _, field := range model.formatFields(format) {
+		supported[field] = true
+	}
+	for _, field := range model.Fields {
+		if supported[field] {
+			continue
+		}
+		var ids []string
+		for _, entry := range entries {
+			if !model.isDefault(field, entry[field]) {
+				ids = append(ids, model.Id(entry))
+			}
+		}
+		if len(ids) > 0 {
+			messages = append(messages, fmt.Sprintf("Field %s is lost in %s format for %s", field, format, strings.Join(ids, ", ")))
+		}
+	}
+	if format == formatDotenv {
+		seen := make(map[any]bool)
+		for _, entry := range entries {
+			if seen[entry["key"]] {
+				messages = append(messages, fmt.Sprintf("Var %s is lost in %s format because key is already defined for another scope", model.Id(entry), format))
+			}
+			seen[entry["key"]] = true
+		}
+	}
+	return messages
+}
+
+// WriteConvertFile writes entries in format.
+func WriteConvertFile(filename string, format string, model fileModel, entries []map[string]any) error {
+	var content []byte
+	var err error
+	switch format {
+	case formatJSON, formatYAML:
+		ordered := make([]json.RawMessage, 0, len(entries))
+		for _, entry := range entries {
+			ordered = append(ordered, orderedJSON(entry, model.Fields))
+		}
+		content, err = json.MarshalIndent(ordered, "", "  ")
+		if err == nil {
+			content = append(content, '\n')
+		}
+		if err == nil && format == formatYAML {
+			content, err = jsonToYAML(content)
+		}
+	case formatCSV:
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		fields := model.formatFields(format)
+		err = writer.Write(fields)
+		for _, entry := range entries {
+			if err != nil {
+				break
+			}
+			record := make([]string, 0, len(fields))
+			for _, field := range fields {
+				record = append(record, csvValue(entry[field]))
+			}
+			err = writer.Write(record)
+		}
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+		content = buffer.Bytes()
+	case formatDotenv:
+		var buffer bytes.Buffer
+		seen := make(map[any]bool)
+		for _, entry := range entries {
+			if seen[entry["key"]] {
+				continue
+			}
+			seen[entry["key"]] = true
+			fmt.Fprintf(&buffer, "%s=%s\n", entry["key"], quoteDotenv(csvValue(entry["value"])))
+		}
+		content = buffer.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, content, 0644)
+}
+
+// orderedJSON encodes an entry with its keys in the order of fields.
+func orderedJSON(entry map[string]any, fields []string) json.RawMessage {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	first := true
+	for _, field := range fields {
+		value, found := entry[field]
+		if !found {
+			continue
+		}
+		if !first {
+			buffer.WriteByte(',')
+		}
+		first = false
+		key, _ := json.Marshal(field)
+		data, _ := json.Marshal(value)
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(data)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
+
+func csvValue(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case bool:
+		return strconv.FormatBool(typed)
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Convert converts a var or env file from a format to another one. The model
+// is detected from the source content when modelName is empty.
+func (glcli *GLCli) Convert(from string, to string, modelName string) {
+	var model fileModel
+	switch modelName {
+	case "":
+	case varsModel.Name:
+		model = varsModel
+	case envsModel.Name:
+		model = envsModel
+	default:
+		log.Fatalf("Unknown model %s (must be %s or %s)", modelName, varsModel.Name, envsModel.Name)
+	}
+	fromFormat, err := DetectFormat(from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	toFormat, err := DetectFormat(to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if toFormat == formatDotenv && model.Name == envsModel.Name {
+		log.Fatalf("%s format only supports vars", formatDotenv)
+	}
+	entries, err := ReadConvertFile(from, fromFormat, &model)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if toFormat == formatDotenv && model.Name != varsModel.Name {
+		log.Fatalf("%s format only supports vars", formatDotenv)
+	}
+	if glcli.Config.VerboseMode {
+		log.Printf("Convert %d %s from %s (%s) to %s (%s)", len(entries), model.Name, from, fromFormat, to, toFormat)
+	}
+	for _, message := range LostFields(entries, toFormat, model) {
+		log.Print(message)
+	}
+	err = WriteConvertFile(to, toFormat, model, entries)
+	if err != nil {
+		log.Fatalf("Cannot write %s: %s", to, err)
+	}
+	log.Printf("Exit now because %s is converted to %s", from, to)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const convertVars = `[
+  {
+    "key": "DEBUG_ENABLED",
+    "value": "1",
+    "description": "",
+    "environment_scope": "*",
+    "raw": true,
+    "hidden": false,
+    "protected": false,
+    "masked": false,
+    "variable_type": "env_var"
+  },
+  {
+    "key": "DEBUG_ENABLED",
+    "value": "0",
+    "description": "Disable debug in production",
+    "environment_scope": "production",
+    "raw": false,
+    "hidden": false,
+    "protected": true,
+    "masked": false,
+    "variable_type": "env_var"
+  },
+  {
+    "key": "GREETING",
+    "value": "it's a \"quoted\"\nmultiline value",
+    "description": "",
+    "environment_scope": "*",
+    "raw": true,
+    "hidden": false,
+    "protected": false,
+    "masked": false,
+    "variable_type": "env_var"
+  }
+]
+`
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "vars.json")
+	err := os.WriteFile(source, []byte(convertVars), 0644)
+	if err != nil {
+		t.Fatalf(`TestConvertRoundTrip(write var file) = %s`, err)
+	}
+	glcli := GLCli{}
+	glcli.Convert(source, filepath.Join(dir, "vars.yml"), "")
+	glcli.Convert(filepath.Join(dir, "vars.yml"), filepath.Join(dir, "vars.csv"), "")
+	glcli.Convert(filepath.Join(dir, "vars.csv"), filepath.Join(dir, "result.json"), "")
+
+	result, err := os.ReadFile(filepath.Join(dir, "result.json"))
+	if err != nil {
+		t.Fatalf(`TestConvertRoundTrip(read result) = %s`, err)
+	}
+	if string(result) != convertVars {
+		t.Errorf(`TestConvertRoundTrip(json -> yaml -> csv -> json) = %s, want %s`, result, convertVars)
+	}
+}
+
+func TestConvertDotenv(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "vars.json")
+	err := os.WriteFile(source, []byte(convertVars), 0644)
+	if err != nil {
+		t.Fatalf(`TestConvertDotenv(write var file) = %s`, err)
+	}
+	model := fileModel{}
+	entries, err := ReadConvertFile(source, formatJSON, &model)
+	if err != nil {
+		t.Fatalf(`TestConvertDotenv(read) = %s`, err)
+	}
+	messages := LostFields(entries, formatDotenv, model)
+	want := []string{
+		"Field description is lost in dotenv format for DEBUG_ENABLED (production)",
+		"Field environment_scope is lost in dotenv format for DEBUG_ENABLED (production)",
+		"Field raw is lost in dotenv format for DEBUG_ENABLED (production)",
+		"Field protected is lost in dotenv format for DEBUG_ENABLED (production)",
+		"Var DEBUG_ENABLED (production) is lost in dotenv format because key is already defined for another scope",
+	}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf(`TestConvertDotenv(lost fields) = %v, want %v`, messages, want)
+	}
+
+	target := filepath.Join(dir, ".env")
+	err = WriteConvertFile(target, formatDotenv, model, entries)
+	if err != nil {
+		t.Fatalf(`TestConvertDotenv(write) = %s`, err)
+	}
+	model = fileModel{}
+	converted, err := ReadConvertFile(target, formatDotenv, &model)
+	if err != nil {
+		t.Fatalf(`TestConvertDotenv(read dotenv) = %s`, err)
+	}
+	if len(converted) != 2 {
+		t.Fatalf(`TestConvertDotenv(count vars) = %d, want %d`, len(converted), 2)
+	}
+	if converted[1]["value"] != "it's a \"quoted\"\nmultiline value" {
+		t.Errorf(`TestConvertDotenv(quoted value) = %q, want %q`, converted[1]["value"], "it's a \"quoted\"\nmultiline value")
+	}
+	if converted[0]["environment_scope"] != "*" || converted[0]["raw"] != true {
+		t.Errorf(`TestConvertDotenv(defaults) = %v, want * scope and raw var`, converted[0])
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	formats := map[string]string{
+		".gitlab-vars.json": formatJSON,
+		"vars.YAML":         formatYAML,
+		"dir/vars.yml":      formatYAML,
+		"audit.csv":         formatCSV,
+		".env":              formatDotenv,
+		".env.production":   formatDotenv,
+		"production.env":    formatDotenv,
+	}
+	for filename, want := range formats {
+		format, err := DetectFormat(filename)
+		if err != nil || format != want {
+			t.Errorf(`TestDetectFormat(%s) = %s (%v), want %s`, filename, format, err, want)
+		}
+	}
+	_, err := DetectFormat("vars.txt")
+	if err == nil {
+		t.Errorf(`TestDetectFormat(vars.txt) = nil, want an error`)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	encryptedPrefix = "ENC[age,"
+	encryptedSuffix = "]"
+)
+
+// ValueCipher encrypts var values for the recipients of a key file and
+// decrypts them with its identities.
+type ValueCipher struct {
+	identities []age.Identity
+	recipients []*age.X25519Recipient
+}
+
+// LoadKeyFile reads an age key file. Each line is an identity
+// (AGE-SECRET-KEY-1...), a recipient (age1...) or a comment. Values are
+// encrypted for all recipients and the public keys of all identities.
+func LoadKeyFile(filename string) (*ValueCipher, error) {
+	cipher := ValueCipher{}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Fatalln("Cannot close key file", err)
+		}
+	}()
+	scanner := bufio.NewScanner(file)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "AGE-SECRET-KEY-1"):
+			identity, err := age.ParseX25519Identity(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", filename, lineno, err)
+			}
+			cipher.identities = append(cipher.identities, identity)
+			cipher.recipients = append(cipher.recipients, identity.Recipient())
+		case strings.HasPrefix(line, "age1"):
+			recipient, err := age.ParseX25519Recipient(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", filename, lineno, err)
+			}
+			cipher.recipients = append(cipher.recipients, recipient)
+		default:
+			return nil, fmt.Errorf("%s line %d: neither an age identity nor an age recipient", filename, lineno)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(cipher.recipients) == 0 {
+		return nil, fmt.Errorf("%s contains no age key", filename)
+	}
+	return &cipher, nil
+}
+
+// Recipients returns the age recipients of the key file.
+func (cipher *ValueCipher) Recipients() []string {
+	recipients := make([]string, 0, len(cipher.recipients))
+	for _, recipient := range cipher.recipients {
+		recipients = append(recipients, recipient.String())
+	}
+	return recipients
+}
+
+// IsEncrypted tells if a value is an encrypted value.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+// Encrypt returns the value encrypted as ENC[age,<base64 age payload>].
+func (cipher *ValueCipher) Encrypt(value string) (string, error) {
+	var buffer bytes.Buffer
+	recipients := make([]age.Recipient, 0, len(cipher.recipients))
+	for _, recipient := range cipher.recipients {
+		recipients = append(recipients, recipient)
+	}
+	writer, err := age.Encrypt(&buffer, recipients...)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(writer, value)
+	if err != nil {
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(buffer.Bytes()) + encryptedSuffix, nil
+}
+
+// Decrypt returns the plain text of an encrypted value.
+func (cipher *ValueCipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("value is not encrypted")
+	}
+	if len(cipher.identities) == 0 {
+		return "", errors.New("key file contains no age identity")
+	}
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix))
+	if err != nil {
+		return "", err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(payload), cipher.identities...)
+	if err != nil {
+		return "", err
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// isSecret tells if the value of a var must be encrypted in var files.
+func isSecret(item VarFileData) bool {
+	return item.IsMasked || item.IsHidden || item.IsProtected
+}
+
+// getCipher loads the key file once.
+func (glcli *GLCli) getCipher() *ValueCipher {
+	if glcli.cipher == nil {
+		_, err := os.Stat(glcli.Config.KeyFile)
+		if err == nil {
+			glcli.checkSecretFile(glcli.Config.KeyFile)
+		}
+		cipher, err := LoadKeyFile(glcli.Config.KeyFile)
+		if err != nil {
+			log.Fatalf("Cannot load key file: %s", err)
+		}
+		if glcli.Config.VerboseMode {
+			log.Printf("Get age keys from: %s", glcli.Config.KeyFile)
+		}
+		glcli.cipher = cipher
+	}
+	return glcli.cipher
+}
+
+// decryptVars replaces encrypted values by their plain text.
+func (glcli *GLCli) decryptVars(data []VarFileData) []VarFileData {
+	for idx, item := range data {
+		if !IsEncrypted(item.Value) {
+			continue
+		}
+		value, err := glcli.getCipher().Decrypt(item.Value)
+		if err != nil {
+			log.Fatalf("Cannot decrypt value of var %s (%s): %s", item.Key, item.Env, err)
+		}
+		data[idx].Value = value
+	}
+	return data
+}
+
+// encryptVars encrypts the values of secret vars. A value which was already
+// encrypted in previous entries with the same plain text keeps its previous
+// encrypted form, so export does not change the file when values are unchanged.
+func (glcli *GLCli) encryptVars(data []VarFileData, previous map[string]VarFileData) []VarFileData {
+	for idx, item := range data {
+		if !isSecret(item) || item.Value == "" || item.Value == hiddenValue || item.ValueFromFile != "" || IsEncrypted(item.Value) {
+			continue
+		}
+		old, found := previous[varId(item.Key, item.Env)]
+		if found && IsEncrypted(old.Value) {
+			plain, err := glcli.getCipher().Decrypt(old.Value)
+			if err == nil && plain == item.Value {
+				data[idx].Value = old.Value
+				continue
+			}
+		}
+		value, err := glcli.getCipher().Encrypt(item.Value)
+		if err != nil {
+			log.Fatalf("Cannot encrypt value of var %s (%s): %s", item.Key, item.Env, err)
+		}
+		data[idx].Value = value
+	}
+	return data
+}
+
+// encryptionIsActive tells if secret values must be encrypted on export: when
+// the key file exists or when the previous var file has encrypted values.
+func (glcli *GLCli) encryptionIsActive(previous map[string]VarFileData) bool {
+	_, err := os.Stat(glcli.Config.KeyFile)
+	if err == nil {
+		return true
+	}
+	for _, item := range previous {
+		if IsEncrypted(item.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encrypt encrypts in place the plain values of secret vars in var files.
+// Without file, the var, group var and global var files of the configuration
+// are processed.
+func (glcli *GLCli) Encrypt(files []string) {
+	if len(files) == 0 {
+		for _, filename := range []string{glcli.Config.VarsFile, glcli.Config.GroupVarsFile, glcli.Config.GlobalVarsFile} {
+			_, err := os.Stat(filename)
+			if err == nil {
+				files = append(files, filename)
+			}
+		}
+	}
+	for _, filename := range files {
+		data, recipients, err := glcli.readVarFile(filename)
+		if err != nil {
+			log.Fatalf("Cannot import var file: %s", err)
+		}
+		if len(recipients) > 0 {
+			log.Printf("Skip %s file because it is SOPS-encrypted", filename)
+			continue
+		}
+		count := 0
+		for _, item := range data {
+			if isSecret(item) && item.Value != "" && item.Value != hiddenValue && item.ValueFromFile == "" && !IsEncrypted(item.Value) {
+				count++
+			}
+		}
+		err = ExportVarFile(filename, glcli.encryptVars(data, nil))
+		if err != nil {
+			log.Fatalf("Cannot export vars to %s: %s", filename, err)
+		}
+		log.Printf("%d value(s) encrypted in %s file", count, filename)
+	}
+}
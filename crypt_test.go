@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func writeTestKeyFile(t *testing.T) string {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf(`writeTestKeyFile(generate identity) = %s`, err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf(`writeTestKeyFile(generate identity) = %s`, err)
+	}
+	keyfile := filepath.Join(t.TempDir(), "age.key")
+	content := "# created: for tests\n" + identity.String() + "\n# teammate\n" + other.Recipient().String() + "\n"
+	err = os.WriteFile(keyfile, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf(`writeTestKeyFile(write key file) = %s`, err)
+	}
+	return keyfile
+}
+
+func TestCryptEncryptDecrypt(t *testing.T) {
+	cipher, err := LoadKeyFile(writeTestKeyFile(t))
+	if err != nil {
+		t.Fatalf(`TestCryptEncryptDecrypt(load key file) = %s`, err)
+	}
+	if len(cipher.recipients) != 2 {
+		t.Errorf(`TestCryptEncryptDecrypt(count recipients) = %d, want %d`, len(cipher.recipients), 2)
+	}
+	encrypted, err := cipher.Encrypt("s3cr3t")
+	if err != nil {
+		t.Fatalf(`TestCryptEncryptDecrypt(encrypt) = %s`, err)
+	}
+	if !IsEncrypted(encrypted) {
+		t.Errorf(`TestCryptEncryptDecrypt(encrypted form) = %s, want ENC[age,...]`, encrypted)
+	}
+	plain, err := cipher.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf(`TestCryptEncryptDecrypt(decrypt) = %s`, err)
+	}
+	if plain != "s3cr3t" {
+		t.Errorf(`TestCryptEncryptDecrypt(decrypt) = %s, want %s`, plain, "s3cr3t")
+	}
+}
+
+func TestCryptEncryptVars(t *testing.T) {
+	glcli := GLCli{}
+	glcli.Config.KeyFile = writeTestKeyFile(t)
+
+	var secret, public VarFileData
+	secret.Key = "PASSWORD"
+	secret.Value = "s3cr3t"
+	secret.Env = "*"
+	secret.IsMasked = true
+	public.Key = "DEBUG_ENABLED"
+	public.Value = "1"
+	public.Env = "*"
+
+	data := glcli.encryptVars([]VarFileData{secret, public}, nil)
+	if !IsEncrypted(data[0].Value) {
+		t.Errorf(`TestCryptEncryptVars(masked var) = %s, want an encrypted value`, data[0].Value)
+	}
+	if data[1].Value != "1" {
+		t.Errorf(`TestCryptEncryptVars(public var) = %s, want %s`, data[1].Value, "1")
+	}
+
+	previous := map[string]VarFileData{varId(secret.Key, secret.Env): data[0]}
+	again := glcli.encryptVars([]VarFileData{secret}, previous)
+	if again[0].Value != data[0].Value {
+		t.Errorf(`TestCryptEncryptVars(unchanged value is encrypted again) = %s, want %s`, again[0].Value, data[0].Value)
+	}
+
+	decrypted := glcli.decryptVars(again)
+	if decrypted[0].Value != "s3cr3t" {
+		t.Errorf(`TestCryptEncryptVars(decrypt) = %s, want %s`, decrypted[0].Value, "s3cr3t")
+	}
+}
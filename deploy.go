@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeployToken is a deploy token of deploy file, matched by name. Gitlab
+// cannot update deploy tokens, so a token whose attributes change is revoked
+// and created again.
+type DeployToken struct {
+	Name      string   `json:"name"`
+	Username  string   `json:"username,omitempty"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+}
+
+// DeployKey is a deploy key of deploy file, matched by title.
+type DeployKey struct {
+	Title   string `json:"title"`
+	Key     string `json:"key"`
+	CanPush bool   `json:"can_push"`
+}
+
+// DeployData is the content of deploy file. Group deploy tokens are only
+// managed when the group_deploy_tokens key is present, as they are shared by
+// all projects of the group.
+type DeployData struct {
+	DeployTokens      []DeployToken  `json:"deploy_tokens"`
+	GroupDeployTokens *[]DeployToken `json:"group_deploy_tokens,omitempty"`
+	DeployKeys        []DeployKey    `json:"deploy_keys"`
+}
+
+// groupTokens returns the group deploy tokens, nil when they are not managed.
+func (data DeployData) groupTokens() []DeployToken {
+	if data.GroupDeployTokens == nil {
+		return nil
+	}
+	return *data.GroupDeployTokens
+}
+
+// GitlabDeployToken is a deploy token as returned by Gitlab API.
+type GitlabDeployToken struct {
+	Id int `json:"id"`
+	DeployToken
+	Token string `json:"token"`
+}
+
+// GitlabDeployKey is a deploy key as returned by Gitlab API.
+type GitlabDeployKey struct {
+	Id int `json:"id"`
+	DeployKey
+}
+
+// DeployTokenUpdate is a deploy token to update with its Gitlab token.
+type DeployTokenUpdate struct {
+	DeployToken
+	Current GitlabDeployToken
+}
+
+// DeployKeyUpdate is a deploy key to update with its Gitlab key.
+type DeployKeyUpdate struct {
+	DeployKey
+	Current GitlabDeployKey
+}
+
+// normalized returns the token with sorted scopes and the expiry date only,
+// as Gitlab gives a timestamp.
+func (token DeployToken) normalized() DeployToken {
+	token.Scopes = slices.Clone(token.Scopes)
+	sort.Strings(token.Scopes)
+	if len(token.ExpiresAt) > len(time.DateOnly) {
+		token.ExpiresAt = token.ExpiresAt[:len(time.DateOnly)]
+	}
+	return token
+}
+
+// Equal tells if both tokens have the same scopes and expiry date. The
+// username is only compared when it is given, as Gitlab generates one.
+func (token DeployToken) Equal(other DeployToken) bool {
+	left := token.normalized()
+	right := other.normalized()
+	if left.Username != "" && left.Username != right.Username {
+		return false
+	}
+	return slices.Equal(left.Scopes, right.Scopes) && left.ExpiresAt == right.ExpiresAt
+}
+
+// ImportDeployFile reads a deploy file and checks that names and titles are
+// given and unique.
+func ImportDeployFile(filename string) (DeployData, error) {
+	var data DeployData
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return data, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	for _, tokens := range [][]DeployToken{data.DeployTokens, data.groupTokens()} {
+		seen := make(map[string]bool)
+		for idx, item := range tokens {
+			if item.Name == "" || len(item.Scopes) == 0 {
+				return data, fmt.Errorf("deploy token %d of %s requires name and scopes", idx+1, filename)
+			}
+			if seen[item.Name] {
+				return data, fmt.Errorf("deploy token %s is defined twice in %s", item.Name, filename)
+			}
+			seen[item.Name] = true
+			if item.ExpiresAt != "" {
+				_, err = time.Parse(time.DateOnly, item.normalized().ExpiresAt)
+				if err != nil {
+					return data, fmt.Errorf("invalid expiry date of deploy token %s in %s: %w", item.Name, filename, err)
+				}
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for idx, item := range data.DeployKeys {
+		if item.Title == "" || item.Key == "" {
+			return data, fmt.Errorf("deploy key %d of %s requires title and key", idx+1, filename)
+		}
+		if seen[item.Title] {
+			return data, fmt.Errorf("deploy key %s is defined twice in %s", item.Title, filename)
+		}
+		seen[item.Title] = true
+	}
+	return data, nil
+}
+
+// ExportDeployFile writes deploy tokens and keys to filename, sorted by name
+// and title.
+func ExportDeployFile(filename string, data DeployData) error {
+	var sorted DeployData
+	sorted.DeployTokens = sortedDeployTokens(data.DeployTokens)
+	if data.GroupDeployTokens != nil {
+		groupTokens := sortedDeployTokens(*data.GroupDeployTokens)
+		sorted.GroupDeployTokens = &groupTokens
+	}
+	sorted.DeployKeys = append([]DeployKey{}, data.DeployKeys...)
+	sort.SliceStable(sorted.DeployKeys, func(i, j int) bool {
+		return sorted.DeployKeys[i].Title < sorted.DeployKeys[j].Title
+	})
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+func sortedDeployTokens(tokens []DeployToken) []DeployToken {
+	sorted := make([]DeployToken, 0, len(tokens))
+	for _, item := range tokens {
+		sorted = append(sorted, item.normalized())
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// CompareDeployTokens compares the deploy tokens of deploy file with the
+// active Gitlab ones.
+func CompareDeployTokens(data []DeployToken, gitlab []GitlabDeployToken) ([]DeployToken, []DeployTokenUpdate, []GitlabDeployToken, error) {
+	var toAdd []DeployToken
+	var toUpdate []DeployTokenUpdate
+	var toDelete []GitlabDeployToken
+	current := make(map[string]GitlabDeployToken)
+	for _, item := range gitlab {
+		if _, found := current[item.Name]; found {
+			return nil, nil, nil, fmt.Errorf("several Gitlab deploy tokens are named %s", item.Name)
+		}
+		current[item.Name] = item
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Name] = true
+		token, found := current[item.Name]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if !item.Equal(token.DeployToken) {
+			toUpdate = append(toUpdate, DeployTokenUpdate{DeployToken: item, Current: token})
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Name] {
+			toDelete = append(toDelete, item)
+		}
+	}
+	return toAdd, toUpdate, toDelete, nil
+}
+
+// CompareDeployKeys compares the deploy keys of deploy file with the Gitlab
+// ones.
+func CompareDeployKeys(data []DeployKey, gitlab []GitlabDeployKey) ([]DeployKey, []DeployKeyUpdate, []GitlabDeployKey, error) {
+	var toAdd []DeployKey
+	var toUpdate []DeployKeyUpdate
+	var toDelete []GitlabDeployKey
+	current := make(map[string]GitlabDeployKey)
+	for _, item := range gitlab {
+		if _, found := current[item.Title]; found {
+			return nil, nil, nil, fmt.Errorf("several Gitlab deploy keys are titled %s", item.Title)
+		}
+		current[item.Title] = item
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Title] = true
+		key, found := current[item.Title]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if sshKey(item.Key) != sshKey(key.Key) || item.CanPush != key.CanPush {
+			toUpdate = append(toUpdate, DeployKeyUpdate{DeployKey: item, Current: key})
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Title] {
+			toDelete = append(toDelete, item)
+		}
+	}
+	return toAdd, toUpdate, toDelete, nil
+}
+
+// sshKey returns the type and the data of a public key, without comment.
+func sshKey(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) > 2 {
+		fields = fields[:2]
+	}
+	return strings.Join(fields, " ")
+}
+
+func deployTokensPath(kind string, id string) string {
+	return kind + "/" + url.PathEscape(id) + "/deploy_tokens"
+}
+
+func deployKeysPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/deploy_keys"
+}
+
+// getDeployTokens returns the active deploy tokens of a project or a group.
+func (glcli *GLCli) getDeployTokens(path string) []GitlabDeployToken {
+	var data []GitlabDeployToken
+	err := glcli.client.GetAll(path+"?active=true", &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch deploy tokens from gitlab: %s", err)
+	}
+	return data
+}
+
+// getDeployKeys returns the deploy keys enabled on the project.
+func (glcli *GLCli) getDeployKeys() []GitlabDeployKey {
+	var data []GitlabDeployKey
+	err := glcli.client.GetAll(deployKeysPath(glcli.ProjectId), &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch deploy keys from gitlab: %s", err)
+	}
+	return data
+}
+
+// exportDeploy writes the deploy tokens and keys of the project in filename.
+// The deploy tokens of its group are only written when the previous deploy
+// file manages them. The file is only written when there is a token or a key
+// or when it exists.
+func (glcli *GLCli) exportDeploy(filename string) {
+	previous, err := ImportDeployFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Cannot read previous deploy file: %s", err)
+	}
+	var data DeployData
+	for _, item := range glcli.getDeployTokens(deployTokensPath("projects", glcli.ProjectId)) {
+		data.DeployTokens = append(data.DeployTokens, item.DeployToken)
+	}
+	if previous.GroupDeployTokens != nil && glcli.GroupId != "" {
+		groupTokens := []DeployToken{}
+		for _, item := range glcli.getDeployTokens(deployTokensPath("groups", glcli.GroupId)) {
+			groupTokens = append(groupTokens, item.DeployToken)
+		}
+		data.GroupDeployTokens = &groupTokens
+	}
+	for _, item := range glcli.getDeployKeys() {
+		data.DeployKeys = append(data.DeployKeys, item.DeployKey)
+	}
+	if len(data.DeployTokens) == 0 && len(data.DeployKeys) == 0 && errors.Is(err, os.ErrNotExist) {
+		if glcli.Config.VerboseMode {
+			log.Printf("No deploy token nor deploy key to export in %s file", filename)
+		}
+		return
+	}
+	err = ExportDeployFile(filename, data)
+	if err != nil {
+		log.Fatalf("Cannot export deploy tokens and keys to %s: %s", filename, err)
+	}
+}
+
+// createDeployToken creates a deploy token and writes its value in the
+// secrets file.
+func (glcli *GLCli) createDeployToken(path string, secret Secret, item DeployToken) error {
+	body := map[string]any{
+		"name":   item.Name,
+		"scopes": item.Scopes,
+	}
+	if item.Username != "" {
+		body["username"] = item.Username
+	}
+	if item.ExpiresAt != "" {
+		body["expires_at"] = item.normalized().ExpiresAt
+	}
+	var token GitlabDeployToken
+	err := glcli.client.Request(http.MethodPost, path, body, &token)
+	if err != nil {
+		return err
+	}
+	secret.Kind = secretDeployToken
+	secret.Name = token.Name
+	secret.Username = token.Username
+	secret.Token = token.Token
+	secret.CreatedAt = time.Now().UTC()
+	err = AppendSecrets(glcli.Config.SecretsFile, []Secret{secret})
+	if err != nil {
+		return fmt.Errorf("cannot write token to %s: %w", glcli.Config.SecretsFile, err)
+	}
+	log.Printf("Create deploy token %s, its value is written to %s file", item.Name, glcli.Config.SecretsFile)
+	return nil
+}
+
+// syncDeployTokens applies deploy tokens on a project or a group. Tokens
+// missing in the file are only revoked in delete mode.
+func (glcli *GLCli) syncDeployTokens(label string, path string, secret Secret, data []DeployToken) {
+	toAdd, toUpdate, toDelete, err := CompareDeployTokens(data, glcli.getDeployTokens(path))
+	if err != nil {
+		log.Fatalf("Cannot compare %s: %s", label, err)
+	}
+	glcli.summary.DeployTokens.count(len(toAdd), len(toUpdate), len(toDelete), glcli.Config.DeleteMode)
+	for _, item := range toAdd {
+		log.Printf("Deploy token %s should be created", item.Name)
+		if !glcli.Config.DryrunMode {
+			err = glcli.createDeployToken(path, secret, item)
+			if err != nil {
+				log.Fatalf("Cannot create deploy token %s: %s", item.Name, err)
+			}
+		}
+	}
+	if len(toAdd) == 0 {
+		log.Printf("No %s to insert", label)
+	}
+	for _, item := range toUpdate {
+		log.Printf("Deploy token %s should be revoked and created again", item.Name)
+		if !glcli.Config.DryrunMode {
+			err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", path, item.Current.Id), nil, nil)
+			if err == nil {
+				err = glcli.createDeployToken(path, secret, item.DeployToken)
+			}
+			if err != nil {
+				log.Fatalf("Cannot replace deploy token %s: %s", item.Name, err)
+			}
+		}
+	}
+	if len(toUpdate) == 0 {
+		log.Printf("No %s to update", label)
+	}
+	if len(toDelete) == 0 {
+		log.Printf("No %s to delete", label)
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, item := range toDelete {
+			err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", path, item.Id), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot revoke deploy token %s: %s", item.Name, err)
+			}
+			log.Printf("Revoke deploy token %s", item.Name)
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d %s(s) may be deleted, but delete flag in command line is not set", len(toDelete), label)
+	}
+}
+
+// syncDeployKeys applies deploy keys on the project. Keys missing in the file
+// are only deleted in delete mode.
+func (glcli *GLCli) syncDeployKeys(data []DeployKey) {
+	path := deployKeysPath(glcli.ProjectId)
+	toAdd, toUpdate, toDelete, err := CompareDeployKeys(data, glcli.getDeployKeys())
+	if err != nil {
+		log.Fatalf("Cannot compare deploy keys: %s", err)
+	}
+	glcli.summary.DeployKeys.count(len(toAdd), len(toUpdate), len(toDelete), glcli.Config.DeleteMode)
+	for _, item := range toAdd {
+		log.Printf("Deploy key %s should be created", item.Title)
+		if !glcli.Config.DryrunMode {
+			err = glcli.client.Request(http.MethodPost, path, item, nil)
+			if err != nil {
+				log.Fatalf("Cannot create deploy key %s: %s", item.Title, err)
+			}
+		}
+	}
+	if len(toAdd) == 0 {
+		log.Print("No deploy key to insert")
+	}
+	for _, item := range toUpdate {
+		log.Printf("Deploy key %s should be updated", item.Title)
+		if !glcli.Config.DryrunMode {
+			if sshKey(item.Key) == sshKey(item.Current.Key) {
+				body := map[string]any{"title": item.Title, "can_push": item.CanPush}
+				err = glcli.client.Request(http.MethodPut, fmt.Sprintf("%s/%d", path, item.Current.Id), body, nil)
+			} else {
+				// Gitlab cannot change the key itself, so the key is replaced
+				err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", path, item.Current.Id), nil, nil)
+				if err == nil {
+					err = glcli.client.Request(http.MethodPost, path, item.DeployKey, nil)
+				}
+			}
+			if err != nil {
+				log.Fatalf("Cannot update deploy key %s: %s", item.Title, err)
+			}
+		}
+	}
+	if len(toUpdate) == 0 {
+		log.Print("No deploy key to update")
+	}
+	if len(toDelete) == 0 {
+		log.Print("No deploy key to delete")
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, item := range toDelete {
+			err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", path, item.Id), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot delete deploy key %s: %s", item.Title, err)
+			}
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d deploy key(s) may be deleted, but delete flag in command line is not set", len(toDelete))
+	}
+}
+
+// syncDeploy applies the deploy file on the project, and on its group when
+// the file manages group deploy tokens.
+func (glcli *GLCli) syncDeploy(filename string) {
+	data, err := ImportDeployFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import deploy file: %s", err)
+	}
+	glcli.syncDeployTokens("deploy token", deployTokensPath("projects", glcli.ProjectId), Secret{ProjectId: glcli.ProjectId}, data.DeployTokens)
+	if data.GroupDeployTokens == nil {
+		if glcli.Config.VerboseMode {
+			log.Print("Group deploy tokens are not managed by deploy file")
+		}
+	} else if glcli.groupSynced {
+		log.Print("Skip group deploy tokens because group is already synced")
+	} else if glcli.GroupId != "" {
+		glcli.syncDeployTokens("group deploy token", deployTokensPath("groups", glcli.GroupId), Secret{GroupId: glcli.GroupId}, *data.GroupDeployTokens)
+	} else if len(*data.GroupDeployTokens) > 0 {
+		log.Fatal("Cannot apply group deploy tokens because group id is unknown")
+	}
+	glcli.syncDeployKeys(data.DeployKeys)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportDeployFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		`{"deploy_tokens": [{"name": "registry", "scopes": ["read_registry"], "expires_at": "2030-01-31"}], "deploy_keys": [{"title": "ci", "key": "ssh-ed25519 AAAA ci@example.com"}]}`: true,
+		`{"deploy_tokens": [{"name": "registry", "scopes": []}]}`:                                                                           false,
+		`{"group_deploy_tokens": [{"name": "registry", "scopes": ["read_registry"], "expires_at": "31/01/2030"}]}`:                          false,
+		`{"deploy_keys": [{"title": "ci", "key": "ssh-ed25519 AAAA"}, {"title": "ci", "key": "ssh-ed25519 BBBB"}]}`:                         false,
+		`{"deploy_tokens": [{"name": "registry", "scopes": ["read_registry"]}, {"name": "registry", "scopes": ["read_package_registry"]}]}`: false,
+	}
+	for content, valid := range tests {
+		filename := filepath.Join(dir, "deploy.json")
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ImportDeployFile(filename)
+		if (err == nil) != valid {
+			t.Errorf(`TestImportDeployFile(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+}
+
+func TestCompareDeployTokens(t *testing.T) {
+	var gitlab []GitlabDeployToken
+	err := json.Unmarshal([]byte(`[
+		{"id": 1, "name": "registry", "username": "gitlab+deploy-token-1", "scopes": ["read_registry", "read_repository"], "expires_at": "2030-01-31T00:00:00.000Z"},
+		{"id": 2, "name": "packages", "username": "gitlab+deploy-token-2", "scopes": ["read_package_registry"], "expires_at": null},
+		{"id": 3, "name": "legacy", "username": "legacy", "scopes": ["read_repository"]}
+	]`), &gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []DeployToken{
+		{Name: "registry", Scopes: []string{"read_repository", "read_registry"}, ExpiresAt: "2030-01-31"},
+		{Name: "packages", Scopes: []string{"read_package_registry", "write_package_registry"}},
+		{Name: "mirror", Scopes: []string{"read_repository"}},
+	}
+	toAdd, toUpdate, toDelete, err := CompareDeployTokens(data, gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toAdd) != 1 || toAdd[0].Name != "mirror" {
+		t.Errorf(`TestCompareDeployTokens(tokens to add) = %v, want only mirror`, toAdd)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].Current.Id != 2 {
+		t.Errorf(`TestCompareDeployTokens(tokens to update) = %v, want only packages`, toUpdate)
+	}
+	if len(toDelete) != 1 || toDelete[0].Id != 3 {
+		t.Errorf(`TestCompareDeployTokens(tokens to delete) = %v, want only legacy`, toDelete)
+	}
+}
+
+func TestCompareDeployKeys(t *testing.T) {
+	gitlab := []GitlabDeployKey{
+		{Id: 1, DeployKey: DeployKey{Title: "ci", Key: "ssh-ed25519 AAAA ci@example.com", CanPush: false}},
+		{Id: 2, DeployKey: DeployKey{Title: "mirror", Key: "ssh-ed25519 BBBB", CanPush: true}},
+	}
+	data := []DeployKey{
+		{Title: "ci", Key: "ssh-ed25519 AAAA", CanPush: true},
+		{Title: "backup", Key: "ssh-ed25519 CCCC"},
+	}
+	toAdd, toUpdate, toDelete, err := CompareDeployKeys(data, gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toAdd) != 1 || toAdd[0].Title != "backup" {
+		t.Errorf(`TestCompareDeployKeys(keys to add) = %v, want only backup`, toAdd)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].Current.Id != 1 || !toUpdate[0].CanPush {
+		t.Errorf(`TestCompareDeployKeys(keys to update) = %v, want only ci with push`, toUpdate)
+	}
+	if len(toDelete) != 1 || toDelete[0].Id != 2 {
+		t.Errorf(`TestCompareDeployKeys(keys to delete) = %v, want only mirror`, toDelete)
+	}
+}
+
+func TestGLCliDeployGroupTokens(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/deploy_tokens": `[{"id": 1, "name": "registry", "scopes": ["read_registry"]}]`,
+		"GET /api/v4/projects/51/deploy_keys":   `[]`,
+		"GET /api/v4/groups/7/deploy_tokens":    `[{"id": 1, "name": "registry", "scopes": ["read_registry"]}]`,
+	})
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.GroupId = "7"
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	filename := filepath.Join(t.TempDir(), "deploy.json")
+
+	glcli.exportDeploy(filename)
+	data, err := ImportDeployFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.DeployTokens) != 1 || data.GroupDeployTokens != nil {
+		t.Errorf(`TestGLCliDeployGroupTokens(new file) = %v, want project tokens only`, data)
+	}
+	glcli.syncDeploy(filename)
+	for _, request := range rec.requests {
+		if strings.Contains(request, "/groups/") {
+			t.Errorf(`TestGLCliDeployGroupTokens(request) = %s, want no group request`, request)
+		}
+	}
+
+	err = os.WriteFile(filename, []byte(`{"deploy_tokens": [], "group_deploy_tokens": [], "deploy_keys": []}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli.exportDeploy(filename)
+	data, err = ImportDeployFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.groupTokens()) != 1 || data.groupTokens()[0].Name != "registry" {
+		t.Errorf(`TestGLCliDeployGroupTokens(group tokens) = %v, want registry`, data.groupTokens())
+	}
+}
+
+func TestGLCliSyncDeploy(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/deploy_tokens": `[{"id": 1, "name": "registry", "scopes": ["read_registry"]}, {"id": 2, "name": "legacy", "scopes": ["read_repository"]}]`,
+		"GET /api/v4/projects/51/deploy_keys": `[{"id": 11, "title": "ci-push", "key": "ssh-ed25519 AAAA1 ci", "can_push": false},
+			{"id": 12, "title": "ci-pull", "key": "ssh-ed25519 AAAA2 ci", "can_push": false},
+			{"id": 13, "title": "old", "key": "ssh-ed25519 AAAA3 ci", "can_push": false}]`,
+		"POST /api/v4/projects/51/deploy_tokens": `{"id": 3, "name": "registry", "username": "gitlab+deploy-token-3", "token": "gldt-registry"}`,
+	})
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "deploy.json")
+	err := os.WriteFile(filename, []byte(`{
+		"deploy_tokens": [{"name": "registry", "scopes": ["read_registry", "write_registry"]}, {"name": "packages", "scopes": ["read_package_registry"]}],
+		"deploy_keys": [{"title": "ci-push", "key": "ssh-ed25519 AAAA1 other comment", "can_push": true}, {"title": "ci-pull", "key": "ssh-ed25519 AAAA4 ci"}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.Config.SecretsFile = filepath.Join(dir, "secrets.json")
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.syncDeploy(filename)
+	rec.expectWrites(t, "TestGLCliSyncDeploy(dry run requests)", nil)
+
+	glcli.Config.DryrunMode = false
+	glcli.syncDeploy(filename)
+	rec.expectWrites(t, "TestGLCliSyncDeploy(requests)", []string{
+		"DELETE /api/v4/projects/51/deploy_keys/12",
+		"DELETE /api/v4/projects/51/deploy_keys/13",
+		"DELETE /api/v4/projects/51/deploy_tokens/1",
+		"DELETE /api/v4/projects/51/deploy_tokens/2",
+		"POST /api/v4/projects/51/deploy_keys",
+		"POST /api/v4/projects/51/deploy_tokens",
+		"POST /api/v4/projects/51/deploy_tokens",
+		"PUT /api/v4/projects/51/deploy_keys/11",
+	})
+	var secrets []Secret
+	content, err := os.ReadFile(glcli.Config.SecretsFile)
+	if err == nil {
+		err = json.Unmarshal(content, &secrets)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 2 || secrets[0].Kind != secretDeployToken || secrets[0].ProjectId != "51" || secrets[1].Token != "gldt-registry" {
+		t.Errorf(`TestGLCliSyncDeploy(secrets) = %v, want the tokens of both created deploy tokens`, secrets)
+	}
+
+	glcli.Config.DeleteMode = false
+	glcli.syncDeploy(filename)
+	for _, request := range rec.writes() {
+		if strings.HasSuffix(request, "/2") || strings.HasSuffix(request, "/13") {
+			t.Errorf(`TestGLCliSyncDeploy(request without delete mode) = %s, want no revoke nor delete`, request)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env command actions: stop stops an env, delete stops and deletes it, and
+// prune stops and deletes the inactive envs matching a pattern.
+const (
+	envsStop   = "stop"
+	envsDelete = "delete"
+	envsPrune  = "prune"
+)
+
+// EnvDetails is a Gitlab env with its activity dates.
+type EnvDetails struct {
+	Id             int       `json:"id"`
+	Name           string    `json:"name"`
+	State          string    `json:"state"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	LastDeployment *struct {
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"last_deployment"`
+}
+
+// LastActivity returns the date of the last deployment, or of the last env
+// update when it is more recent.
+func (env EnvDetails) LastActivity() time.Time {
+	last := env.UpdatedAt
+	if env.LastDeployment != nil && env.LastDeployment.CreatedAt.After(last) {
+		last = env.LastDeployment.CreatedAt
+	}
+	return last
+}
+
+// ParseAge parses a duration like time.ParseDuration, with the d unit for days.
+func ParseAge(text string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(text, "d"); found {
+		count, err := strconv.Atoi(days)
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid duration %s", text)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(text)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid duration %s", text)
+	}
+	return age, nil
+}
+
+// StaleEnvs returns the envs whose name matches and whose last activity is
+// before limit.
+func StaleEnvs(envs []EnvDetails, match func(name string) bool, limit time.Time) []EnvDetails {
+	var stale []EnvDetails
+	for _, env := range envs {
+		if match(env.Name) && env.LastActivity().Before(limit) {
+			stale = append(stale, env)
+		}
+	}
+	return stale
+}
+
+// getEnvDetails returns the env of the project with its last deployment.
+func (glcli *GLCli) getEnvDetails(id int) EnvDetails {
+	var env EnvDetails
+	err := glcli.client.Request(http.MethodGet, fmt.Sprintf("%s/%d", envsPath(glcli.ProjectId), id), nil, &env)
+	if err != nil {
+		log.Fatalf("Cannot fetch env %d from gitlab: %s", id, err)
+	}
+	return env
+}
+
+// findEnv returns the env of the project with this name.
+func (glcli *GLCli) findEnv(name string) EnvDetails {
+	settings := glcli.getEnvSettings()
+	env, found := settings[name]
+	if !found {
+		log.Fatalf("Cannot find env %s on gitlab", name)
+	}
+	return glcli.getEnvDetails(env.Id)
+}
+
+func (glcli *GLCli) stopEnv(env EnvDetails) error {
+	if env.State == "stopped" {
+		return nil
+	}
+	err := glcli.client.Request(http.MethodPost, fmt.Sprintf("%s/%d/stop", envsPath(glcli.ProjectId), env.Id), nil, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Stop env %s", env.Name)
+	return nil
+}
+
+// deleteEnv stops the env, as Gitlab only deletes stopped envs, and deletes it.
+func (glcli *GLCli) deleteEnv(env EnvDetails) error {
+	err := glcli.stopEnv(env)
+	if err != nil {
+		return err
+	}
+	err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", envsPath(glcli.ProjectId), env.Id), nil, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Delete env %s", env.Name)
+	return nil
+}
+
+// confirm asks the user to confirm the question on stdin.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// EnvsOptions are the options of the envs command. Pattern and age select
+// the envs to prune, and assume yes skips the confirmation.
+type EnvsOptions struct {
+	Pattern   string
+	Age       string
+	AssumeYes bool
+}
+
+// Envs stops or deletes the env named by name, or prunes the inactive envs,
+// after confirmation. Nothing is changed in dryrun mode.
+func (glcli *GLCli) Envs(action string, name string, options EnvsOptions) {
+	var envs []EnvDetails
+	switch action {
+	case envsStop, envsDelete:
+		if name == "" {
+			log.Fatalf("Envs %s action requires an env name", action)
+		}
+		envs = append(envs, glcli.findEnv(name))
+	case envsPrune:
+		if options.Pattern == "" || options.Age == "" {
+			log.Fatal("Envs prune action requires match and older-than options")
+		}
+		match, err := pathMatcher(options.Pattern)
+		if err != nil {
+			log.Fatalf("Cannot prune envs: %s", err)
+		}
+		age, err := ParseAge(options.Age)
+		if err != nil {
+			log.Fatalf("Cannot prune envs: %s", err)
+		}
+		var all []EnvDetails
+		for _, env := range glcli.getEnvSettings() {
+			if match(env.Name) {
+				all = append(all, glcli.getEnvDetails(env.Id))
+			}
+		}
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].Name < all[j].Name
+		})
+		envs = StaleEnvs(all, match, time.Now().Add(-age))
+	default:
+		log.Fatalf("Unknown envs action %s (must be %s, %s or %s)", action, envsStop, envsDelete, envsPrune)
+	}
+	if len(envs) == 0 {
+		log.Print("Exit now because no env matches")
+		return
+	}
+	verb := "Delete"
+	if action == envsStop {
+		verb = "Stop"
+	}
+	for _, env := range envs {
+		log.Printf("%s env %s (%s, last activity on %s)", verb, env.Name, env.State, env.LastActivity().Format(time.DateOnly))
+	}
+	if glcli.Config.DryrunMode {
+		log.Print("Exit now because dryrun mode is active")
+		return
+	}
+	if !options.AssumeYes && !confirm(fmt.Sprintf("%s %d env(s)?", verb, len(envs))) {
+		log.Print("Exit now because action is not confirmed")
+		return
+	}
+	var errs []error
+	for _, env := range envs {
+		var err error
+		if action == envsStop {
+			err = glcli.stopEnv(env)
+		} else {
+			err = glcli.deleteEnv(env)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", env.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		log.Fatalf("Cannot %s envs: %s", action, errors.Join(errs...))
+	}
+	log.Printf("Exit now because %d env(s) are processed", len(envs))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"720h": 720 * time.Hour,
+		"90m":  90 * time.Minute,
+	}
+	for text, want := range tests {
+		age, err := ParseAge(text)
+		if err != nil || age != want {
+			t.Errorf(`TestParseAge(%s) = %s (%v), want %s`, text, age, err, want)
+		}
+	}
+	for _, text := range []string{"", "d", "-3d", "month"} {
+		_, err := ParseAge(text)
+		if err == nil {
+			t.Errorf(`TestParseAge(%s) = nil, want error`, text)
+		}
+	}
+}
+
+func TestStaleEnvs(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	envs := []EnvDetails{
+		{Id: 1, Name: "review/old", UpdatedAt: old},
+		{Id: 2, Name: "review/deployed", UpdatedAt: old},
+		{Id: 3, Name: "review/recent", UpdatedAt: now.Add(-time.Hour)},
+		{Id: 4, Name: "production", UpdatedAt: old},
+	}
+	envs[1].LastDeployment = &struct {
+		CreatedAt time.Time `json:"created_at"`
+	}{CreatedAt: now.Add(-24 * time.Hour)}
+	match, err := pathMatcher("review/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := StaleEnvs(envs, match, now.Add(-30*24*time.Hour))
+	if len(stale) != 1 || stale[0].Name != "review/old" {
+		t.Errorf(`TestStaleEnvs(stale envs) = %v, want only review/old`, stale)
+	}
+}
+
+func TestGLCliDeleteEnv(t *testing.T) {
+	server, rec := newRecordingServer(t, nil)
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	err := glcli.deleteEnv(EnvDetails{Id: 8, Name: "review/old", State: "available"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "POST /api/v4/projects/51/environments/8/stop, DELETE /api/v4/projects/51/environments/8"
+	if strings.Join(rec.requests, ", ") != want {
+		t.Errorf(`TestGLCliDeleteEnv(requests) = %s, want %s`, strings.Join(rec.requests, ", "), want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/didier13150/gitlablib"
+)
+
+// EnvFileData is an env of env file. It extends the gitlablib env with the
+// attributes which gitlablib does not handle.
+type EnvFileData struct {
+	gitlablib.GitlabEnvData
+	Tier            string         `json:"tier,omitempty"`
+	AutoStopSetting string         `json:"auto_stop_setting,omitempty"`
+	AutoStopIn      string         `json:"auto_stop_in,omitempty"`
+	Protection      *EnvProtection `json:"protection,omitempty"`
+}
+
+// Validate checks the tier, the auto-stop setting and the protection of env.
+// Empty tier and auto-stop setting are left unchanged on Gitlab. The auto-stop
+// delay is not supported and refused, as no Gitlab API can set it.
+func (env EnvFileData) Validate() error {
+	if env.Tier != "" && !slices.Contains(envTiers, env.Tier) {
+		return fmt.Errorf("tier %s is not allowed (must be one of %s)", env.Tier, strings.Join(envTiers, ", "))
+	}
+	if env.AutoStopSetting != "" && !slices.Contains(envAutoStopSettings, env.AutoStopSetting) {
+		return fmt.Errorf("auto-stop setting %s is not allowed (must be one of %s)", env.AutoStopSetting, strings.Join(envAutoStopSettings, ", "))
+	}
+	if env.AutoStopIn != "" {
+		return errors.New("auto_stop_in is not supported because no Gitlab API can set it, use the environment:auto_stop_in keyword of .gitlab-ci.yml")
+	}
+	err := env.Protection.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid protection: %w", err)
+	}
+	return nil
+}
+
+// ImportEnvFile reads an env file.
+func ImportEnvFile(filename string) ([]EnvFileData, error) {
+	var data []EnvFileData
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	for _, item := range data {
+		err = item.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid env %s in %s: %w", item.Name, filename, err)
+		}
+	}
+	return data, nil
+}
+
+// ExportEnvFile writes envs to filename, sorted by name.
+func ExportEnvFile(filename string, data []EnvFileData) error {
+	sorted := make([]EnvFileData, len(data))
+	copy(sorted, data)
+	sortEnvData(sorted)
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// toEnvFileData returns gitlablib envs as env file entries.
+func toEnvFileData(envs []gitlablib.GitlabEnvData) []EnvFileData {
+	data := make([]EnvFileData, 0, len(envs))
+	for _, item := range envs {
+		data = append(data, EnvFileData{GitlabEnvData: item})
+	}
+	return data
+}
+
+// toGitlabEnvData returns env file entries as gitlablib envs.
+func toGitlabEnvData(data []EnvFileData) []gitlablib.GitlabEnvData {
+	envs := make([]gitlablib.GitlabEnvData, 0, len(data))
+	for _, item := range data {
+		envs = append(envs, item.GitlabEnvData)
+	}
+	return envs
+}
+
+// readEnvFile reads the env file, which may not exist.
+func (glcli *GLCli) readEnvFile() []EnvFileData {
+	data, err := ImportEnvFile(glcli.Config.EnvsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return []EnvFileData{}
+	}
+	if err != nil {
+		log.Fatalf("Cannot import env file: %s", err)
+	}
+	return data
+}
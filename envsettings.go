@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// Tiers of deployment environments.
+var envTiers = []string{"production", "staging", "testing", "development", "other"}
+
+// Auto-stop settings of environments: always stops the environment when its
+// auto-stop time is reached, with_action only when a stop action is defined.
+var envAutoStopSettings = []string{"always", "with_action"}
+
+// envSettings are the attributes of a Gitlab env which gitlablib does not
+// handle.
+type envSettings struct {
+	Id              int    `json:"id"`
+	Name            string `json:"name"`
+	Tier            string `json:"tier"`
+	AutoStopSetting string `json:"auto_stop_setting"`
+}
+
+func envsPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/environments"
+}
+
+// getEnvSettings returns the settings of the envs of the project by name.
+func (glcli *GLCli) getEnvSettings() map[string]envSettings {
+	var data []envSettings
+	err := glcli.client.GetAll(envsPath(glcli.ProjectId), &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch env settings from gitlab: %s", err)
+	}
+	settings := make(map[string]envSettings)
+	for _, item := range data {
+		settings[item.Name] = item
+	}
+	return settings
+}
+
+// withEnvSettings returns envs with their tier and auto-stop setting.
+func withEnvSettings(data []EnvFileData, settings map[string]envSettings) []EnvFileData {
+	for idx := range data {
+		data[idx].Tier = settings[data[idx].Name].Tier
+		data[idx].AutoStopSetting = settings[data[idx].Name].AutoStopSetting
+	}
+	return data
+}
+
+// CompareEnvSettings returns the envs of env file whose tier or auto-stop
+// setting differs on Gitlab. Envs missing on Gitlab are returned too, as they
+// are created without these settings.
+func CompareEnvSettings(data []EnvFileData, settings map[string]envSettings) []EnvFileData {
+	var toUpdate []EnvFileData
+	for _, item := range data {
+		current, found := settings[item.Name]
+		if item.Tier == "" && item.AutoStopSetting == "" {
+			continue
+		}
+		if found && (item.Tier == "" || item.Tier == current.Tier) && (item.AutoStopSetting == "" || item.AutoStopSetting == current.AutoStopSetting) {
+			continue
+		}
+		toUpdate = append(toUpdate, item)
+	}
+	return toUpdate
+}
+
+// updateEnvSettings sets the tier and the auto-stop setting of an existing
+// Gitlab env.
+func (glcli *GLCli) updateEnvSettings(id int, item EnvFileData) error {
+	body := make(map[string]string)
+	if item.Tier != "" {
+		body["tier"] = item.Tier
+	}
+	if item.AutoStopSetting != "" {
+		body["auto_stop_setting"] = item.AutoStopSetting
+	}
+	err := glcli.client.Request(http.MethodPut, fmt.Sprintf("%s/%d", envsPath(glcli.ProjectId), id), body, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Set tier %s and auto-stop setting %s to env %s", item.Tier, item.AutoStopSetting, item.Name)
+	return nil
+}
+
+// syncEnvSettings applies the tier and the auto-stop setting of env file on
+// Gitlab. It runs after envs creation, so new envs get their settings too, but
+// envs created in the same run are already counted as inserted.
+func (glcli *GLCli) syncEnvSettings(data []EnvFileData, created []string) {
+	settings := glcli.getEnvSettings()
+	toUpdate := CompareEnvSettings(data, settings)
+	updated := 0
+	for _, item := range toUpdate {
+		if !slices.Contains(created, item.Name) {
+			updated++
+		}
+	}
+	glcli.summary.Envs.count(0, updated, 0, glcli.Config.DeleteMode)
+	for _, item := range toUpdate {
+		log.Printf("Settings of env %s should be updated", item.Name)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		current, found := settings[item.Name]
+		if !found {
+			log.Fatalf("Cannot update settings of env %s because it is not found on gitlab", item.Name)
+		}
+		err := glcli.updateEnvSettings(current.Id, item)
+		if err != nil {
+			log.Fatalf("Cannot update settings of env %s: %s", item.Name, err)
+		}
+	}
+	if len(toUpdate) == 0 {
+		log.Print("No env settings to update")
+	}
+}
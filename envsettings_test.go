@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnvValidate(t *testing.T) {
+	tests := []struct {
+		tier     string
+		autoStop string
+		valid    bool
+	}{
+		{"", "", true},
+		{"production", "always", true},
+		{"development", "with_action", true},
+		{"prod", "", false},
+		{"staging", "never", false},
+	}
+	for _, test := range tests {
+		var env EnvFileData
+		env.Name = "review"
+		env.Tier = test.tier
+		env.AutoStopSetting = test.autoStop
+		err := env.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf(`TestEnvValidate(%s, %s) = %v, want valid %t`, test.tier, test.autoStop, err, test.valid)
+		}
+	}
+	var env EnvFileData
+	env.Name = "review"
+	env.AutoStopIn = "1 week"
+	if env.Validate() == nil {
+		t.Errorf(`TestEnvValidate(auto_stop_in) = nil, want an error`)
+	}
+}
+
+func TestCompareEnvSettings(t *testing.T) {
+	settings := map[string]envSettings{
+		"production": {Id: 1, Name: "production", Tier: "production", AutoStopSetting: "always"},
+		"staging":    {Id: 2, Name: "staging", Tier: "other", AutoStopSetting: "always"},
+		"review":     {Id: 3, Name: "review", Tier: "development", AutoStopSetting: "always"},
+	}
+	var production, staging, review, qa EnvFileData
+	production.Name = "production"
+	production.Tier = "production"
+	production.AutoStopSetting = "always"
+	staging.Name = "staging"
+	staging.Tier = "staging"
+	review.Name = "review"
+	qa.Name = "qa"
+	qa.Tier = "testing"
+
+	toUpdate := CompareEnvSettings([]EnvFileData{production, staging, review, qa}, settings)
+	if len(toUpdate) != 2 || toUpdate[0].Name != "staging" || toUpdate[1].Name != "qa" {
+		t.Errorf(`TestCompareEnvSettings(envs to update) = %v, want staging and qa`, toUpdate)
+	}
+
+	envs := withEnvSettings([]EnvFileData{review, qa}, settings)
+	if envs[0].Tier != "development" || envs[0].AutoStopSetting != "always" {
+		t.Errorf(`TestCompareEnvSettings(exported review) = %s %s, want development always`, envs[0].Tier, envs[0].AutoStopSetting)
+	}
+	if envs[1].Tier != "" {
+		t.Errorf(`TestCompareEnvSettings(exported qa tier) = %s, want empty`, envs[1].Tier)
+	}
+}
+
+func TestGLCliSyncEnvSettings(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/12/environments": `[{"id": 1, "name": "production", "tier": "other"}, {"id": 2, "name": "review", "tier": "other"}]`,
+	})
+	glcli := GLCli{}
+	glcli.ProjectId = "12"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	var production, review EnvFileData
+	production.Name = "production"
+	production.Tier = "production"
+	review.Name = "review"
+	review.Tier = "development"
+
+	glcli.syncEnvSettings([]EnvFileData{production, review}, []string{"review"})
+	rec.expectWrites(t, "TestGLCliSyncEnvSettings(requests)", []string{
+		"PUT /api/v4/projects/12/environments/1",
+		"PUT /api/v4/projects/12/environments/2",
+	})
+	if glcli.summary.Envs != (ChangeCount{Update: 1}) {
+		t.Errorf(`TestGLCliSyncEnvSettings(summary) = %s, want %s`, glcli.summary.Envs, ChangeCount{Update: 1})
+	}
+}
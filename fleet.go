@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Fleet actions: apply imports files in Gitlab, plan shows the changes which
+// apply would make, and pull exports Gitlab in files.
+const (
+	fleetApply = "apply"
+	fleetPlan  = "plan"
+	fleetPull  = "pull"
+)
+
+// ChangeCount counts the changes of a kind of resource. Resources which would
+// be deleted are counted as extra when delete mode is not active, and hidden
+// vars whose value is pushed on each run are counted apart from updates.
+type ChangeCount struct {
+	Add    int
+	Update int
+	Delete int
+	Extra  int
+	Hidden int
+}
+
+func (count *ChangeCount) count(add int, update int, del int, deleteMode bool) {
+	count.Add += add
+	count.Update += update
+	if deleteMode {
+		count.Delete += del
+	} else {
+		count.Extra += del
+	}
+}
+
+func (count *ChangeCount) add(other ChangeCount) {
+	count.Add += other.Add
+	count.Update += other.Update
+	count.Delete += other.Delete
+	count.Extra += other.Extra
+	count.Hidden += other.Hidden
+}
+
+func (count ChangeCount) IsZero() bool {
+	return count == ChangeCount{}
+}
+
+func (count ChangeCount) String() string {
+	text := fmt.Sprintf("+%d ~%d -%d", count.Add, count.Update, count.Delete)
+	if count.Extra > 0 {
+		text += fmt.Sprintf(" (%d extra)", count.Extra)
+	}
+	if count.Hidden > 0 {
+		text += fmt.Sprintf(" (%d hidden pushed)", count.Hidden)
+	}
+	return text
+}
+
+// SyncSummary counts the changes made, or planned, by a project sync.
+type SyncSummary struct {
+	Envs              ChangeCount
+	Vars              ChangeCount
+	GroupVars         ChangeCount
+	Schedules         ChangeCount
+	Triggers          ChangeCount
+	DeployTokens      ChangeCount
+	DeployKeys        ChangeCount
+	ProtectedBranches ChangeCount
+	ProtectedTags     ChangeCount
+	CISettings        ChangeCount
+	JobTokenAllowlist ChangeCount
+	Hooks             ChangeCount
+	Labels            ChangeCount
+}
+
+// summaryColumns are the columns of the fleet summary.
+var summaryColumns = []struct {
+	Name  string
+	Count func(summary *SyncSummary) *ChangeCount
+}{
+	{"ENVS", func(summary *SyncSummary) *ChangeCount { return &summary.Envs }},
+	{"VARS", func(summary *SyncSummary) *ChangeCount { return &summary.Vars }},
+	{"GROUP VARS", func(summary *SyncSummary) *ChangeCount { return &summary.GroupVars }},
+	{"SCHEDULES", func(summary *SyncSummary) *ChangeCount { return &summary.Schedules }},
+	{"TRIGGERS", func(summary *SyncSummary) *ChangeCount { return &summary.Triggers }},
+	{"DEPLOY TOKENS", func(summary *SyncSummary) *ChangeCount { return &summary.DeployTokens }},
+	{"DEPLOY KEYS", func(summary *SyncSummary) *ChangeCount { return &summary.DeployKeys }},
+	{"PROTECTED BRANCHES", func(summary *SyncSummary) *ChangeCount { return &summary.ProtectedBranches }},
+	{"PROTECTED TAGS", func(summary *SyncSummary) *ChangeCount { return &summary.ProtectedTags }},
+	{"CI SETTINGS", func(summary *SyncSummary) *ChangeCount { return &summary.CISettings }},
+	{"JOB TOKEN ALLOWLIST", func(summary *SyncSummary) *ChangeCount { return &summary.JobTokenAllowlist }},
+	{"HOOKS", func(summary *SyncSummary) *ChangeCount { return &summary.Hooks }},
+	{"LABELS", func(summary *SyncSummary) *ChangeCount { return &summary.Labels }},
+}
+
+const summaryFixedColumns = 3
+
+// FleetProject is a project given by its id or its path with namespace.
+type FleetProject string
+
+func (project *FleetProject) UnmarshalJSON(data []byte) error {
+	var id int
+	err := json.Unmarshal(data, &id)
+	if err == nil {
+		*project = FleetProject(strconv.Itoa(id))
+		return nil
+	}
+	var path string
+	err = json.Unmarshal(data, &path)
+	if err != nil {
+		return errors.New("project must be an id or a path with namespace")
+	}
+	*project = FleetProject(path)
+	return nil
+}
+
+// FleetEntry is a project of the fleet manifest with its files. Files default
+// to the default file names in a directory named as the project path, and
+// relative paths are relative to the manifest directory.
+type FleetEntry struct {
+	Project        FleetProject `json:"project"`
+	VarsFile       string       `json:"varfile,omitempty"`
+	EnvsFile       string       `json:"envfile,omitempty"`
+	GroupVarsFile  string       `json:"groupvarfile,omitempty"`
+	SchedulesFile  string       `json:"schedulefile,omitempty"`
+	TriggersFile   string       `json:"triggerfile,omitempty"`
+	DeployFile     string       `json:"deployfile,omitempty"`
+	ProtectedFile  string       `json:"protectedfile,omitempty"`
+	CISettingsFile string       `json:"cisettingsfile,omitempty"`
+	HooksFile      string       `json:"hookfile,omitempty"`
+	LabelsFile     string       `json:"labelfile,omitempty"`
+}
+
+// ImportFleetFile reads a fleet manifest.
+func ImportFleetFile(filename string) ([]FleetEntry, error) {
+	var entries []FleetEntry
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	for idx, entry := range entries {
+		if entry.Project == "" {
+			return nil, fmt.Errorf("entry %d of %s has no project", idx+1, filename)
+		}
+	}
+	return entries, nil
+}
+
+// CachedProject is a project of the project file.
+type CachedProject struct {
+	Id                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Visibility        string `json:"visibility"`
+	Namespace         struct {
+		Id   int    `json:"id"`
+		Kind string `json:"kind"`
+	} `json:"namespace"`
+}
+
+// GroupId returns the id of the project group, or an empty id for projects
+// of users.
+func (project CachedProject) GroupId() string {
+	if project.Namespace.Kind != "group" {
+		return ""
+	}
+	return strconv.Itoa(project.Namespace.Id)
+}
+
+// ProjectCache finds projects by id or path. It is loaded once from the
+// project file, and projects missing in this file are fetched from Gitlab.
+type ProjectCache struct {
+	projects map[string]CachedProject
+	client   *GitlabClient
+}
+
+func (glcli *GLCli) loadProjectCache() *ProjectCache {
+	cache := ProjectCache{projects: make(map[string]CachedProject), client: &glcli.client}
+	var projects []CachedProject
+	content, err := os.ReadFile(glcli.Config.ProjectsFile)
+	if err == nil {
+		err = json.Unmarshal(content, &projects)
+	}
+	if err != nil {
+		if glcli.Config.VerboseMode {
+			log.Printf("Cannot use %s file: %s", glcli.Config.ProjectsFile, err)
+		}
+		return &cache
+	}
+	for _, project := range projects {
+		cache.add(project)
+	}
+	if glcli.Config.VerboseMode {
+		log.Printf("%d project(s) in cache from %s file", len(projects), glcli.Config.ProjectsFile)
+	}
+	return &cache
+}
+
+func (cache *ProjectCache) add(project CachedProject) {
+	cache.projects[strconv.Itoa(project.Id)] = project
+	cache.projects[project.PathWithNamespace] = project
+}
+
+// Find returns a project given by its id or its path with namespace.
+func (cache *ProjectCache) Find(ref string) (CachedProject, error) {
+	project, found := cache.projects[ref]
+	if found {
+		return project, nil
+	}
+	err := cache.client.Request(http.MethodGet, "projects/"+url.PathEscape(ref), nil, &project)
+	if err != nil {
+		return project, err
+	}
+	cache.add(project)
+	return project, nil
+}
+
+// entryFile returns a file of a fleet entry.
+func entryFile(manifest string, project CachedProject, file string, defaultFile string) string {
+	if file == "" {
+		file = filepath.Join(filepath.FromSlash(project.PathWithNamespace), filepath.Base(defaultFile))
+	}
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(manifest), file)
+}
+
+// fleetLabelsFile returns the label file of a manifest entry with the labels
+// option: the label file of the entry, or the label file shared by the
+// projects which have none.
+func fleetLabelsFile(manifest string, project CachedProject, entry FleetEntry, shared string) string {
+	if entry.LabelsFile == "" {
+		return shared
+	}
+	return entryFile(manifest, project, entry.LabelsFile, shared)
+}
+
+// Fleet applies, plans or pulls all projects of a fleet manifest, or the
+// projects of the project file which match the selection, then shows a
+// summary of the changes. Selected projects are applied and planned with the
+// var file only, without envs, group vars nor deletion, so a var file can be
+// shared by all of them. Group vars, group deploy tokens and group hooks are
+// applied once per group, with the files of its first project. With labels,
+// only the label file is applied or planned on each project. It stops at the
+// first error, as Run does.
+func (glcli *GLCli) Fleet(action string, manifest string, selection ProjectSelection, labels bool) {
+	switch action {
+	case fleetApply:
+	case fleetPlan:
+		glcli.Config.DryrunMode = true
+	case fleetPull:
+		glcli.Config.ExportMode = true
+	default:
+		log.Fatalf("Unknown fleet action %s (must be %s, %s or %s)", action, fleetApply, fleetPlan, fleetPull)
+	}
+	if labels && action == fleetPull {
+		log.Fatal("Labels option is not available with pull because projects share the label file")
+	}
+	var entries []FleetEntry
+	var err error
+	shared := !selection.IsEmpty() && action != fleetPull
+	if selection.IsEmpty() {
+		entries, err = ImportFleetFile(manifest)
+		if err != nil {
+			log.Fatalf("Cannot import fleet manifest: %s", err)
+		}
+	}
+	glcli.Setup()
+	glcli.getResolver()
+	cache := glcli.loadProjectCache()
+	if !selection.IsEmpty() {
+		manifest = ""
+		projects, err := cache.Select(selection)
+		if err != nil {
+			log.Fatalf("Cannot select projects: %s", err)
+		}
+		for _, project := range projects {
+			entries = append(entries, FleetEntry{Project: FleetProject(project.PathWithNamespace)})
+		}
+		log.Printf("%d project(s) selected in %s file", len(entries), glcli.Config.ProjectsFile)
+	}
+	labelsDelete := labels && glcli.Config.DeleteMode
+	if labelsDelete {
+		glcli.Config.DeleteMode = false
+	} else if shared && glcli.Config.DeleteMode {
+		log.Print("Delete mode is ignored because var file is shared by selected projects")
+		glcli.Config.DeleteMode = false
+	}
+
+	paths := make([]string, 0, len(entries))
+	summaries := make([]SyncSummary, 0, len(entries))
+	groups := make(map[string]string)
+	for _, entry := range entries {
+		project, err := cache.Find(string(entry.Project))
+		if err != nil {
+			log.Fatalf("Cannot find project %s: %s", entry.Project, err)
+		}
+		member := *glcli
+		member.ProjectId = strconv.Itoa(project.Id)
+		if labels {
+			member.initClients()
+			member.summary = SyncSummary{}
+			member.Config.LabelsFile = fleetLabelsFile(manifest, project, entry, glcli.Config.LabelsFile)
+			if entry.LabelsFile != "" {
+				member.Config.DeleteMode = labelsDelete
+			} else if labelsDelete {
+				log.Printf("Delete mode is ignored for project %s because label file %s is shared by projects", project.PathWithNamespace, member.Config.LabelsFile)
+			}
+			log.Printf("Sync labels of project %s (id %d) with %s file", project.PathWithNamespace, project.Id, member.Config.LabelsFile)
+			member.syncLabels("projects", member.ProjectId, member.Config.LabelsFile)
+			paths = append(paths, project.PathWithNamespace)
+			summaries = append(summaries, member.summary)
+			continue
+		}
+		member.GroupId = project.GroupId()
+		member.Config.VarsFile = entryFile(manifest, project, entry.VarsFile, glcli.Config.VarsFile)
+		member.Config.EnvsFile = entryFile(manifest, project, entry.EnvsFile, glcli.Config.EnvsFile)
+		member.Config.GroupVarsFile = entryFile(manifest, project, entry.GroupVarsFile, glcli.Config.GroupVarsFile)
+		member.Config.SchedulesFile = entryFile(manifest, project, entry.SchedulesFile, glcli.Config.SchedulesFile)
+		member.Config.TriggersFile = entryFile(manifest, project, entry.TriggersFile, glcli.Config.TriggersFile)
+		member.Config.DeployFile = entryFile(manifest, project, entry.DeployFile, glcli.Config.DeployFile)
+		member.Config.ProtectedFile = entryFile(manifest, project, entry.ProtectedFile, glcli.Config.ProtectedFile)
+		member.Config.CISettingsFile = entryFile(manifest, project, entry.CISettingsFile, glcli.Config.CISettingsFile)
+		member.Config.HooksFile = entryFile(manifest, project, entry.HooksFile, glcli.Config.HooksFile)
+		member.Config.LabelsFile = entryFile(manifest, project, entry.LabelsFile, glcli.Config.LabelsFile)
+		member.Config.RequestedFiles = nil
+		for _, file := range []struct{ entry, config, member string }{
+			{entry.SchedulesFile, glcli.Config.SchedulesFile, member.Config.SchedulesFile},
+			{entry.TriggersFile, glcli.Config.TriggersFile, member.Config.TriggersFile},
+			{entry.DeployFile, glcli.Config.DeployFile, member.Config.DeployFile},
+			{entry.ProtectedFile, glcli.Config.ProtectedFile, member.Config.ProtectedFile},
+			{entry.CISettingsFile, glcli.Config.CISettingsFile, member.Config.CISettingsFile},
+			{entry.HooksFile, glcli.Config.HooksFile, member.Config.HooksFile},
+			{entry.LabelsFile, glcli.Config.LabelsFile, member.Config.LabelsFile},
+		} {
+			// Files of the manifest, or requested for all projects, are pulled
+			if file.entry != "" || slices.Contains(glcli.Config.RequestedFiles, file.config) {
+				member.Config.RequestedFiles = append(member.Config.RequestedFiles, file.member)
+			}
+		}
+		if shared {
+			member.GroupId = ""
+			member.Config.VarsFile = glcli.Config.VarsFile
+			member.Config.EnvsFile = ""
+			member.Config.GroupVarsFile = ""
+			member.Config.SchedulesFile = ""
+			member.Config.TriggersFile = ""
+			member.Config.DeployFile = ""
+			member.Config.ProtectedFile = ""
+			member.Config.CISettingsFile = ""
+			member.Config.HooksFile = ""
+			member.Config.LabelsFile = ""
+		}
+		if member.GroupId != "" && action != fleetPull {
+			path, found := groups[member.GroupId]
+			if found {
+				log.Printf("Group %s of project %s is already synced with project %s, its group vars, group deploy tokens and group hooks are skipped", member.GroupId, project.PathWithNamespace, path)
+				member.groupSynced = true
+			} else {
+				groups[member.GroupId] = project.PathWithNamespace
+			}
+		}
+		if action == fleetPull {
+			for _, filename := range []string{member.Config.VarsFile, member.Config.EnvsFile, member.Config.GroupVarsFile, member.Config.SchedulesFile, member.Config.TriggersFile, member.Config.DeployFile, member.Config.ProtectedFile, member.Config.CISettingsFile, member.Config.HooksFile, member.Config.LabelsFile} {
+				err = os.MkdirAll(filepath.Dir(filename), 0755)
+				if err != nil {
+					log.Fatalf("Cannot create directory of %s: %s", filename, err)
+				}
+			}
+		}
+		member.initClients()
+		log.Printf("Sync project %s (id %d) with %s file", project.PathWithNamespace, project.Id, member.Config.VarsFile)
+		member.sync()
+		paths = append(paths, project.PathWithNamespace)
+		summaries = append(summaries, member.summary)
+	}
+
+	if action == fleetPull {
+		log.Printf("%d project(s) exported", len(paths))
+		return
+	}
+	err = WriteFleetSummary(os.Stdout, paths, summaries)
+	if err != nil {
+		log.Fatalf("Cannot write summary: %s", err)
+	}
+	if action == fleetPlan {
+		log.Print("Nothing changed because plan is a dry run")
+	}
+}
+
+// WriteFleetSummary writes the changes of each project and their total as a
+// table. Columns after the group vars are only written when a project has
+// changes in them.
+func WriteFleetSummary(out io.Writer, paths []string, summaries []SyncSummary) error {
+	var total SyncSummary
+	for idx := range summaries {
+		for _, column := range summaryColumns {
+			column.Count(&total).add(*column.Count(&summaries[idx]))
+		}
+	}
+	header := "PROJECT"
+	var columns []int
+	for idx, column := range summaryColumns {
+		if idx < summaryFixedColumns || !column.Count(&total).IsZero() {
+			header += "\t" + column.Name
+			columns = append(columns, idx)
+		}
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, header)
+	for idx := range summaries {
+		row := paths[idx]
+		for _, column := range columns {
+			row += "\t" + summaryColumns[column].Count(&summaries[idx]).String()
+		}
+		fmt.Fprintln(writer, row)
+	}
+	row := "TOTAL"
+	for _, column := range columns {
+		row += "\t" + summaryColumns[column].Count(&total).String()
+	}
+	fmt.Fprintln(writer, row)
+	return writer.Flush()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFleetManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "fleet.json")
+	content := `[
+  {"project": 12},
+  {"project": "infra/api", "varfile": "api/vars.json"}
+]`
+	err := os.WriteFile(manifest, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf(`TestFleetManifest(write manifest) = %s`, err)
+	}
+	entries, err := ImportFleetFile(manifest)
+	if err != nil {
+		t.Fatalf(`TestFleetManifest(import) = %s`, err)
+	}
+	if entries[0].Project != "12" || entries[1].Project != "infra/api" {
+		t.Errorf(`TestFleetManifest(projects) = %s, %s, want %s, %s`, entries[0].Project, entries[1].Project, "12", "infra/api")
+	}
+
+	var project CachedProject
+	project.PathWithNamespace = "infra/api"
+	varfile := entryFile(manifest, project, entries[1].VarsFile, ".gitlab-vars.json")
+	if varfile != filepath.Join(dir, "api", "vars.json") {
+		t.Errorf(`TestFleetManifest(var file) = %s, want %s`, varfile, filepath.Join(dir, "api", "vars.json"))
+	}
+	envfile := entryFile(manifest, project, entries[1].EnvsFile, ".gitlab-envs.json")
+	if envfile != filepath.Join(dir, "infra", "api", ".gitlab-envs.json") {
+		t.Errorf(`TestFleetManifest(default env file) = %s, want %s`, envfile, filepath.Join(dir, "infra", "api", ".gitlab-envs.json"))
+	}
+	labelfile := fleetLabelsFile(manifest, project, FleetEntry{Project: "infra/api", LabelsFile: "api/labels.json"}, "labels.json")
+	if labelfile != filepath.Join(dir, "api", "labels.json") {
+		t.Errorf(`TestFleetManifest(label file) = %s, want %s`, labelfile, filepath.Join(dir, "api", "labels.json"))
+	}
+	labelfile = fleetLabelsFile(manifest, project, entries[1], "labels.json")
+	if labelfile != "labels.json" {
+		t.Errorf(`TestFleetManifest(shared label file) = %s, want %s`, labelfile, "labels.json")
+	}
+}
+
+func TestFleetProjectCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.EscapedPath() != "/api/v4/projects/infra%2Fweb" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 13, "path_with_namespace": "infra/web", "namespace": {"id": 4, "kind": "group"}}`))
+	}))
+	defer server.Close()
+	glcli := GLCli{}
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	glcli.Config.ProjectsFile = filepath.Join(t.TempDir(), "projects.json")
+	err := os.WriteFile(glcli.Config.ProjectsFile, []byte(`[{"id": 12, "path_with_namespace": "dev/api", "namespace": {"id": 7, "kind": "user"}}]`), 0644)
+	if err != nil {
+		t.Fatalf(`TestFleetProjectCache(write project file) = %s`, err)
+	}
+	cache := glcli.loadProjectCache()
+
+	project, err := cache.Find("12")
+	if err != nil || project.PathWithNamespace != "dev/api" || project.GroupId() != "" {
+		t.Errorf(`TestFleetProjectCache(project from file) = %v, %v, want dev/api without group`, project, err)
+	}
+	for idx := 0; idx < 2; idx++ {
+		project, err = cache.Find("infra/web")
+		if err != nil || project.Id != 13 || project.GroupId() != "4" {
+			t.Errorf(`TestFleetProjectCache(project from Gitlab) = %v, %v, want id 13 in group 4`, project, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf(`TestFleetProjectCache(count requests) = %d, want %d`, requests, 1)
+	}
+}
+
+func TestFleetChangeCount(t *testing.T) {
+	var count ChangeCount
+	count.count(1, 2, 3, false)
+	if count.String() != "+1 ~2 -0 (3 extra)" {
+		t.Errorf(`TestFleetChangeCount(without delete mode) = %s, want %s`, count, "+1 ~2 -0 (3 extra)")
+	}
+	count.count(0, 0, 1, true)
+	if count.String() != "+1 ~2 -1 (3 extra)" {
+		t.Errorf(`TestFleetChangeCount(with delete mode) = %s, want %s`, count, "+1 ~2 -1 (3 extra)")
+	}
+}
+
+func TestWriteFleetSummary(t *testing.T) {
+	var api, web SyncSummary
+	api.Vars.count(1, 0, 0, false)
+	web.DeployKeys.count(0, 1, 0, false)
+	var buffer bytes.Buffer
+	err := WriteFleetSummary(&buffer, []string{"infra/api", "infra/web"}, []SyncSummary{api, web})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf(`TestWriteFleetSummary(lines) = %d, want %d`, len(lines), 4)
+	}
+	header := strings.Join(strings.Fields(lines[0]), " ")
+	if header != "PROJECT ENVS VARS GROUP VARS DEPLOY KEYS" {
+		t.Errorf(`TestWriteFleetSummary(header) = %s, want %s`, header, "PROJECT ENVS VARS GROUP VARS DEPLOY KEYS")
+	}
+	if !strings.HasSuffix(lines[3], "+0 ~1 -0") {
+		t.Errorf(`TestWriteFleetSummary(total) = %s, want deploy keys total +0 ~1 -0`, lines[3])
+	}
+}
+
+func TestFleetGroupSynced(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/12/hooks":         `[]`,
+		"GET /api/v4/projects/12/deploy_tokens": `[]`,
+		"GET /api/v4/projects/12/deploy_keys":   `[]`,
+	})
+	dir := t.TempDir()
+	hookfile := filepath.Join(dir, "hooks.json")
+	err := os.WriteFile(hookfile, []byte(`{"hooks": [], "group_hooks": [{"url": "https://ci.example.com/hook", "events": ["push"]}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployfile := filepath.Join(dir, "deploy.json")
+	err = os.WriteFile(deployfile, []byte(`{"deploy_tokens": [], "group_deploy_tokens": [{"name": "registry", "scopes": ["read_registry"]}], "deploy_keys": []}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "12"
+	glcli.GroupId = "7"
+	glcli.groupSynced = true
+	glcli.Config.DeleteMode = true
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	glcli.syncHookFile(hookfile)
+	glcli.syncDeploy(deployfile)
+	want := []string{"GET /api/v4/projects/12/hooks", "GET /api/v4/projects/12/deploy_tokens", "GET /api/v4/projects/12/deploy_keys"}
+	if strings.Join(rec.requests, ", ") != strings.Join(want, ", ") {
+		t.Errorf(`TestFleetGroupSynced(requests) = %v, want %v`, rec.requests, want)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// writeJSONFile writes data in the canonical form of glcli files: two spaces
+// indentation and a trailing newline.
+func writeJSONFile(filename string, data any, perm os.FileMode) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(content, '\n'), perm)
+}
+
+func sortVarFileData(data []VarFileData) {
+	sort.SliceStable(data, func(i, j int) bool {
+		if data[i].Key != data[j].Key {
+			return data[i].Key < data[j].Key
+		}
+		return data[i].Env < data[j].Env
+	})
+}
+
+func sortEnvData(data []EnvFileData) {
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Name < data[j].Name
+	})
+}
+
+// FormatProjectFile rewrites a project file sorted by path_with_namespace.
+// Entries are kept as is, so all project attributes are preserved.
+func FormatProjectFile(filename string) error {
+	var data []json.RawMessage
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	paths := make(map[int]string)
+	for idx, item := range data {
+		var project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		}
+		err = json.Unmarshal(item, &project)
+		if err != nil {
+			return fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+		paths[idx] = project.PathWithNamespace
+	}
+	order := make([]int, len(data))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return paths[order[i]] < paths[order[j]]
+	})
+	sorted := make([]json.RawMessage, 0, len(data))
+	for _, idx := range order {
+		var buffer bytes.Buffer
+		err = json.Compact(&buffer, data[idx])
+		if err != nil {
+			return err
+		}
+		sorted = append(sorted, buffer.Bytes())
+	}
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// detectFileModel guesses the kind of glcli file from the keys of its first
+// entry: vars have a key, projects a path_with_namespace and envs a name.
+// YAML files are decoded like var files, and SOPS files are detected as such.
+func detectFileModel(filename string) (string, error) {
+	var data []map[string]json.RawMessage
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	if varFileFormat(filename) == formatYAML {
+		content, err = yamlToJSON(content)
+		if err != nil {
+			return "", fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		var wrapped map[string]json.RawMessage
+		if json.Unmarshal(content, &wrapped) != nil {
+			return "", fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+		if _, found := wrapped[sopsMetadataKey]; found {
+			return "sops", nil
+		}
+		if _, found := wrapped[sopsVarsKey]; found {
+			return "vars", nil
+		}
+		return "", fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	if len(data) == 0 {
+		return "empty", nil
+	}
+	if _, found := data[0]["key"]; found {
+		return "vars", nil
+	}
+	if _, found := data[0]["path_with_namespace"]; found {
+		return "projects", nil
+	}
+	if _, found := data[0]["name"]; found {
+		return "envs", nil
+	}
+	return "", fmt.Errorf("cannot detect the content type of %s", filename)
+}
+
+// FormatFile rewrites a var, env or project file in its canonical form. SOPS
+// files are left as is.
+func FormatFile(filename string) error {
+	model, err := detectFileModel(filename)
+	if err != nil {
+		return err
+	}
+	switch model {
+	case "vars":
+		data, err := ImportVarFile(filename)
+		if err != nil {
+			return err
+		}
+		return ExportVarFile(filename, data)
+	case "envs":
+		data, err := ImportEnvFile(filename)
+		if err != nil {
+			return err
+		}
+		return ExportEnvFile(filename, data)
+	case "projects":
+		return FormatProjectFile(filename)
+	case "sops":
+		// Rewriting a SOPS file would break its MAC.
+		return nil
+	}
+	return writeJSONFile(filename, []any{}, 0644)
+}
+
+// Format rewrites files in their canonical form. Without file, all existing
+// files of the configuration are formatted.
+func (glcli *GLCli) Format(files []string) {
+	if len(files) == 0 {
+		for _, filename := range []string{glcli.Config.VarsFile, glcli.Config.GroupVarsFile, glcli.Config.GlobalVarsFile, glcli.Config.EnvsFile, glcli.Config.ProjectsFile} {
+			_, err := os.Stat(filename)
+			if err == nil {
+				files = append(files, filename)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				log.Fatalf("Cannot open %s file: %s", filename, err)
+			}
+		}
+	}
+	for _, filename := range files {
+		err := FormatFile(filename)
+		if err != nil {
+			log.Fatalf("Cannot format %s file: %s", filename, err)
+		}
+		if glcli.Config.VerboseMode {
+			log.Printf("File %s is formatted", filename)
+		}
+	}
+	log.Printf("Exit now because %d file(s) are formatted", len(files))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatVarFile(t *testing.T) {
+	varfile := filepath.Join(t.TempDir(), "vars.json")
+	content := `[{"key": "B", "value": "2", "environment_scope": "*"},
+{"masked": false, "key": "A", "value": "1", "environment_scope": "production"},
+{"key": "A", "value": "0", "environment_scope": "*"}]`
+	err := os.WriteFile(varfile, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf(`TestFormatVarFile(write var file) = %s`, err)
+	}
+	err = FormatFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatVarFile(format) = %s`, err)
+	}
+	data, err := ImportVarFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatVarFile(import) = %s`, err)
+	}
+	want := []string{"A@*", "A@production", "B@*"}
+	for idx, item := range data {
+		if varId(item.Key, item.Env) != want[idx] {
+			t.Errorf(`TestFormatVarFile(var %d) = %s, want %s`, idx, varId(item.Key, item.Env), want[idx])
+		}
+	}
+	formatted, err := os.ReadFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatVarFile(read var file) = %s`, err)
+	}
+	err = FormatFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatVarFile(format twice) = %s`, err)
+	}
+	again, err := os.ReadFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatVarFile(read var file) = %s`, err)
+	}
+	if string(formatted) != string(again) {
+		t.Errorf(`TestFormatVarFile(format is not idempotent) = %s, want %s`, again, formatted)
+	}
+	if formatted[len(formatted)-1] != '\n' {
+		t.Errorf(`TestFormatVarFile(trailing newline) = %q, want %q`, formatted[len(formatted)-1], '\n')
+	}
+}
+
+func TestFormatProjectFile(t *testing.T) {
+	projectfile := filepath.Join(t.TempDir(), "projects.json")
+	content := `[{"id": 2, "name": "GLCli", "path_with_namespace": "sources/glcli", "visibility": "public"},
+{"id": 1, "name": "Gitlab CE", "path_with_namespace": "arm64v8/gitlab-ce", "visibility": "public"}]`
+	err := os.WriteFile(projectfile, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf(`TestFormatProjectFile(write project file) = %s`, err)
+	}
+	err = FormatFile(projectfile)
+	if err != nil {
+		t.Fatalf(`TestFormatProjectFile(format) = %s`, err)
+	}
+	formatted, err := os.ReadFile(projectfile)
+	if err != nil {
+		t.Fatalf(`TestFormatProjectFile(read project file) = %s`, err)
+	}
+	want := `[
+  {
+    "id": 1,
+    "name": "Gitlab CE",
+    "path_with_namespace": "arm64v8/gitlab-ce",
+    "visibility": "public"
+  },
+  {
+    "id": 2,
+    "name": "GLCli",
+    "path_with_namespace": "sources/glcli",
+    "visibility": "public"
+  }
+]
+`
+	if string(formatted) != want {
+		t.Errorf(`TestFormatProjectFile(content) = %s, want %s`, formatted, want)
+	}
+}
+
+func TestFormatYAMLVarFile(t *testing.T) {
+	varfile := filepath.Join(t.TempDir(), "vars.yaml")
+	content := `- key: B
+  value: "2"
+  environment_scope: "*"
+- key: A
+  value: "1"
+  environment_scope: "*"
+`
+	err := os.WriteFile(varfile, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf(`TestFormatYAMLVarFile(write var file) = %s`, err)
+	}
+	model, err := detectFileModel(varfile)
+	if err != nil || model != "vars" {
+		t.Fatalf(`TestFormatYAMLVarFile(detect) = %s, %v, want vars, nil`, model, err)
+	}
+	err = FormatFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatYAMLVarFile(format) = %s`, err)
+	}
+	data, err := ImportVarFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestFormatYAMLVarFile(import) = %s`, err)
+	}
+	if len(data) != 2 || data[0].Key != "A" || data[1].Key != "B" {
+		t.Errorf(`TestFormatYAMLVarFile(vars) = %v, want A then B`, data)
+	}
+}
+
+func TestFormatSopsFile(t *testing.T) {
+	for _, name := range []string{"sops-vars.json", "sops-vars.yaml"} {
+		model, err := detectFileModel(filepath.Join("testdata", name))
+		if err != nil || model != "sops" {
+			t.Errorf(`TestFormatSopsFile(detect %s) = %s, %v, want sops, nil`, name, model, err)
+		}
+	}
+}
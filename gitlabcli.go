@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -12,34 +15,66 @@ import (
 )
 
 type GLCliConfig struct {
-	GitlabUrl      string
-	IdFile         string
-	GroupIdFile    string
-	VarsFile       string
-	GroupVarsFile  string
-	GlobalVarsFile string
-	EnvsFile       string
-	ProjectsFile   string
-	DebugFile      string
-	TokenFile      string
-	RemoteName     string
-	DebugMode      bool
-	VerboseMode    bool
-	DryrunMode     bool
-	ExportMode     bool
-	DeleteMode     bool
-	BootstrapMode  bool
+	GitlabUrl          string
+	IdFile             string
+	GroupIdFile        string
+	VarsFile           string
+	GroupVarsFile      string
+	GlobalVarsFile     string
+	EnvsFile           string
+	ProjectsFile       string
+	FleetFile          string
+	SchedulesFile      string
+	TriggersFile       string
+	DeployFile         string
+	ProtectedFile      string
+	CISettingsFile     string
+	HooksFile          string
+	LabelsFile         string
+	RequestedFiles     []string
+	SecretsFile        string
+	DebugFile          string
+	TokenFile          string
+	TokenHelper        string
+	TokenExpiryWarning int
+	KeyFile            string
+	VaultAddr          string
+	VaultNamespace     string
+	VaultTokenFile     string
+	RemoteName         string
+	DebugMode          bool
+	VerboseMode        bool
+	DryrunMode         bool
+	ExportMode         bool
+	ReadOnlyMode       bool
+	DeleteMode         bool
+	BootstrapMode      bool
+	SopsMode           bool
+	AdminMode          bool
+	AllowInsecureFiles bool
+	AllowExecRefs      bool
+	GroupOnlyMode      bool
+	RecursiveMode      bool
+	SetHookTokens      bool
+	IncludeGroups      string
+	ExcludeGroups      string
 }
 
 type GLCli struct {
-	Config     GLCliConfig
-	ProjectId  string
-	GroupId    string
-	RemoteName string
-	token      string
-	vars       gitlablib.GitlabVar
-	envs       gitlablib.GitlabEnv
-	projects   gitlablib.GitlabProject
+	Config      GLCliConfig
+	ProjectId   string
+	GroupId     string
+	RemoteName  string
+	token       string
+	summary     SyncSummary
+	client      GitlabClient
+	cipher      *ValueCipher
+	resolver    *ValueResolver
+	vault       *VaultClient
+	vars        gitlablib.GitlabVar
+	envs        gitlablib.GitlabEnv
+	projects    gitlablib.GitlabProject
+	groupSynced bool
 }
 
 func NewGLCli() GLCli {
@@ -85,11 +120,90 @@ func NewGLCli() GLCli {
 	} else {
 		glcli.Config.ProjectsFile = os.Getenv("HOME") + "/.gitlab-projects.json"
 	}
+	if len(os.Getenv("GLCLI_FLEET_FILE")) > 0 {
+		glcli.Config.FleetFile = os.Getenv("GLCLI_FLEET_FILE")
+	} else {
+		glcli.Config.FleetFile = ".gitlab-fleet.json"
+	}
+	if len(os.Getenv("GLCLI_SCHEDULE_FILE")) > 0 {
+		glcli.Config.SchedulesFile = os.Getenv("GLCLI_SCHEDULE_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.SchedulesFile)
+	} else {
+		glcli.Config.SchedulesFile = ".gitlab-schedules.json"
+	}
+	if len(os.Getenv("GLCLI_TRIGGER_FILE")) > 0 {
+		glcli.Config.TriggersFile = os.Getenv("GLCLI_TRIGGER_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.TriggersFile)
+	} else {
+		glcli.Config.TriggersFile = ".gitlab-triggers.json"
+	}
+	if len(os.Getenv("GLCLI_DEPLOY_FILE")) > 0 {
+		glcli.Config.DeployFile = os.Getenv("GLCLI_DEPLOY_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.DeployFile)
+	} else {
+		glcli.Config.DeployFile = ".gitlab-deploy.json"
+	}
+	if len(os.Getenv("GLCLI_PROTECTED_FILE")) > 0 {
+		glcli.Config.ProtectedFile = os.Getenv("GLCLI_PROTECTED_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.ProtectedFile)
+	} else {
+		glcli.Config.ProtectedFile = ".gitlab-protected.json"
+	}
+	if len(os.Getenv("GLCLI_CI_SETTINGS_FILE")) > 0 {
+		glcli.Config.CISettingsFile = os.Getenv("GLCLI_CI_SETTINGS_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.CISettingsFile)
+	} else {
+		glcli.Config.CISettingsFile = ".gitlab-ci-settings.json"
+	}
+	if len(os.Getenv("GLCLI_HOOK_FILE")) > 0 {
+		glcli.Config.HooksFile = os.Getenv("GLCLI_HOOK_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.HooksFile)
+	} else {
+		glcli.Config.HooksFile = ".gitlab-hooks.json"
+	}
+	if len(os.Getenv("GLCLI_LABEL_FILE")) > 0 {
+		glcli.Config.LabelsFile = os.Getenv("GLCLI_LABEL_FILE")
+		glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, glcli.Config.LabelsFile)
+	} else {
+		glcli.Config.LabelsFile = ".gitlab-labels.json"
+	}
+	if len(os.Getenv("GLCLI_SECRET_FILE")) > 0 {
+		glcli.Config.SecretsFile = os.Getenv("GLCLI_SECRET_FILE")
+	} else {
+		glcli.Config.SecretsFile = os.Getenv("HOME") + "/.gitlab-secrets.json"
+	}
 	if len(os.Getenv("GLCLI_TOKEN_FILE")) > 0 {
 		glcli.Config.TokenFile = os.Getenv("GLCLI_TOKEN_FILE")
 	} else {
 		glcli.Config.TokenFile = os.Getenv("HOME") + "/.gitlab.token"
 	}
+	glcli.Config.TokenHelper = os.Getenv("GLCLI_TOKEN_HELPER")
+	glcli.Config.TokenExpiryWarning = 30
+	if len(os.Getenv("GLCLI_TOKEN_EXPIRY_WARNING")) > 0 {
+		days, err := strconv.Atoi(os.Getenv("GLCLI_TOKEN_EXPIRY_WARNING"))
+		if err != nil {
+			log.Fatalf("Invalid GLCLI_TOKEN_EXPIRY_WARNING environment variable: %s", err)
+		}
+		glcli.Config.TokenExpiryWarning = days
+	}
+	if len(os.Getenv("GLCLI_KEY_FILE")) > 0 {
+		glcli.Config.KeyFile = os.Getenv("GLCLI_KEY_FILE")
+	} else if len(os.Getenv("SOPS_AGE_KEY_FILE")) > 0 {
+		glcli.Config.KeyFile = os.Getenv("SOPS_AGE_KEY_FILE")
+	} else {
+		glcli.Config.KeyFile = os.Getenv("HOME") + "/.gitlab-age.key"
+	}
+	if len(os.Getenv("VAULT_ADDR")) > 0 {
+		glcli.Config.VaultAddr = os.Getenv("VAULT_ADDR")
+	} else {
+		glcli.Config.VaultAddr = "https://127.0.0.1:8200"
+	}
+	glcli.Config.VaultNamespace = os.Getenv("VAULT_NAMESPACE")
+	if len(os.Getenv("GLCLI_VAULT_TOKEN_FILE")) > 0 {
+		glcli.Config.VaultTokenFile = os.Getenv("GLCLI_VAULT_TOKEN_FILE")
+	} else {
+		glcli.Config.VaultTokenFile = os.Getenv("HOME") + "/.vault-token"
+	}
 	if len(os.Getenv("GLCLI_DEBUG_FILE")) > 0 {
 		glcli.Config.DebugFile = os.Getenv("GLCLI_DEBUG_FILE")
 	} else {
@@ -105,8 +219,16 @@ func NewGLCli() GLCli {
 	glcli.Config.VerboseMode = false
 	glcli.Config.DryrunMode = false
 	glcli.Config.ExportMode = false
+	glcli.Config.ReadOnlyMode = false
 	glcli.Config.DeleteMode = false
 	glcli.Config.BootstrapMode = false
+	glcli.Config.SopsMode = false
+	glcli.Config.AdminMode = false
+	glcli.Config.AllowInsecureFiles = false
+	glcli.Config.AllowExecRefs = false
+	glcli.Config.GroupOnlyMode = false
+	glcli.Config.RecursiveMode = false
+	glcli.Config.SetHookTokens = false
 
 	return glcli
 }
@@ -117,7 +239,9 @@ func (glcli *GLCli) SetProjectParameters(allProjects bool, simpleRequest bool) {
 }
 
 func (glcli *GLCli) AddVar() {
-	var newvar gitlablib.GitlabVarData
+	var newvar VarFileData
+	var data []VarFileData
+	var recipients []string
 	scanner := bufio.NewScanner(os.Stdin)
 
 	varfile, err := os.OpenFile(glcli.Config.VarsFile, os.O_RDONLY, 0644)
@@ -126,7 +250,10 @@ func (glcli *GLCli) AddVar() {
 		if err != nil {
 			log.Fatalln("Cannot close var file")
 		}
-		glcli.vars.ImportVars(glcli.Config.VarsFile)
+		data, recipients, err = glcli.readVarFile(glcli.Config.VarsFile)
+		if err != nil {
+			log.Fatalf("Cannot import var file: %s", err)
+		}
 	}
 
 	fmt.Print("Variable key []: ")
@@ -137,9 +264,28 @@ func (glcli *GLCli) AddVar() {
 		log.Fatal("Key cannot be empty\n")
 	}
 
-	fmt.Print("Variable value ['']: ")
+	fmt.Print("Variable type ['env_var']: ")
 	scanner.Scan()
-	newvar.Value = scanner.Text()
+	if scanner.Text() != "" {
+		newvar.VariableType = strings.TrimSpace(scanner.Text())
+		if newvar.VariableType != varTypeEnv && newvar.VariableType != varTypeFile {
+			log.Fatalf("Type must be %s or %s\n", varTypeEnv, varTypeFile)
+		}
+	} else {
+		newvar.VariableType = varTypeEnv
+	}
+
+	if newvar.VariableType == varTypeFile {
+		fmt.Print("Variable value file [null]: ")
+		scanner.Scan()
+		newvar.ValueFromFile = strings.TrimSpace(scanner.Text())
+	}
+
+	if newvar.ValueFromFile == "" {
+		fmt.Print("Variable value ['']: ")
+		scanner.Scan()
+		newvar.Value = scanner.Text()
+	}
 
 	fmt.Print("Variable environment ['*']: ")
 	scanner.Scan()
@@ -187,23 +333,18 @@ func (glcli *GLCli) AddVar() {
 		newvar.IsMasked = false
 	}
 
-	glcli.vars.GitlabData = append(glcli.vars.FileData, newvar)
-	glcli.vars.ExportVars(glcli.Config.VarsFile)
+	err = glcli.writeVarFile(glcli.Config.VarsFile, append(data, newvar), recipients)
+	if err != nil {
+		log.Fatalf("Cannot export vars to %s: %s", glcli.Config.VarsFile, err)
+	}
 	log.Print("Exit now because var is added to vars file")
 }
 
 func (glcli *GLCli) AddEnv() {
-	var newenv gitlablib.GitlabEnvData
+	var newenv EnvFileData
 	scanner := bufio.NewScanner(os.Stdin)
 
-	envfile, err := os.OpenFile(glcli.Config.EnvsFile, os.O_RDONLY, 0644)
-	if err == nil {
-		err = envfile.Close()
-		if err != nil {
-			log.Fatalln("Cannot close env file")
-		}
-		glcli.envs.ImportEnvs(glcli.Config.EnvsFile)
-	}
+	data := glcli.readEnvFile()
 
 	fmt.Print("Environment name []: ")
 	scanner.Scan()
@@ -233,13 +374,33 @@ func (glcli *GLCli) AddEnv() {
 		newenv.State = "available"
 	}
 
-	glcli.envs.GitlabData = append(glcli.envs.FileData, newenv)
-	glcli.envs.ExportEnvs(glcli.Config.EnvsFile)
+	fmt.Printf("Environment tier (%s) [null]: ", strings.Join(envTiers, ", "))
+	scanner.Scan()
+	if scanner.Text() != "" {
+		newenv.Tier = strings.TrimSpace(scanner.Text())
+	}
+
+	fmt.Printf("Environment auto-stop setting (%s) [null]: ", strings.Join(envAutoStopSettings, ", "))
+	scanner.Scan()
+	if scanner.Text() != "" {
+		newenv.AutoStopSetting = strings.TrimSpace(scanner.Text())
+	}
+
+	err := newenv.Validate()
+	if err != nil {
+		log.Fatalf("Cannot add env %s: %s", newenv.Name, err)
+	}
+	err = ExportEnvFile(glcli.Config.EnvsFile, append(data, newenv))
+	if err != nil {
+		log.Fatalf("Cannot export envs to %s: %s", glcli.Config.EnvsFile, err)
+	}
 	log.Print("Exit now because env is added to envs file")
 }
 
 func (glcli *GLCli) CopyVars(envfrom string, envto string) {
-	var newvar gitlablib.GitlabVarData
+	var newvar VarFileData
+	var data []VarFileData
+	var recipients []string
 
 	varfile, err := os.OpenFile(glcli.Config.VarsFile, os.O_RDONLY, 0644)
 	if err == nil {
@@ -247,38 +408,36 @@ func (glcli *GLCli) CopyVars(envfrom string, envto string) {
 		if err != nil {
 			log.Fatalln("Cannot close var file")
 		}
-		glcli.vars.ImportVars(glcli.Config.VarsFile)
-	}
-	envfile, err := os.OpenFile(glcli.Config.EnvsFile, os.O_RDONLY, 0644)
-	if err == nil {
-		err = envfile.Close()
+		data, recipients, err = glcli.readVarFile(glcli.Config.VarsFile)
 		if err != nil {
-			log.Fatalln("Cannot close env file")
+			log.Fatalf("Cannot import var file: %s", err)
 		}
-		glcli.envs.ImportEnvs(glcli.Config.EnvsFile)
 	}
+	envs := glcli.readEnvFile()
 
 	// Check if envto exists or create it (in file) before processing
 	found := false
-	for _, env := range glcli.envs.FileData {
+	for _, env := range envs {
 		if env.Name == envto {
 			found = true
 		}
 	}
 	if !found {
 		// Add env to
-		var newenv gitlablib.GitlabEnvData
+		var newenv EnvFileData
 		newenv.Name = envto
-		glcli.envs.GitlabData = append(glcli.envs.FileData, newenv)
-		glcli.envs.ExportEnvs(glcli.Config.EnvsFile)
+		err = ExportEnvFile(glcli.Config.EnvsFile, append(envs, newenv))
+		if err != nil {
+			log.Fatalf("Cannot export envs to %s: %s", glcli.Config.EnvsFile, err)
+		}
 	}
 
-	var toAdd []gitlablib.GitlabVarData
-	for _, variable := range glcli.vars.FileData {
+	var toAdd []VarFileData
+	for _, variable := range data {
 		if variable.Env == envfrom {
 			log.Printf("Found %s (%s)", variable.Key, variable.Env)
 			found := false
-			for _, var2 := range glcli.vars.FileData {
+			for _, var2 := range data {
 				if var2.Env == envto && var2.Key == variable.Key {
 					found = true
 				}
@@ -291,24 +450,27 @@ func (glcli *GLCli) CopyVars(envfrom string, envto string) {
 		}
 	}
 
-	glcli.vars.GitlabData = append(glcli.vars.FileData, toAdd...)
-	glcli.vars.ExportVars(glcli.Config.VarsFile)
+	err = glcli.writeVarFile(glcli.Config.VarsFile, append(data, toAdd...), recipients)
+	if err != nil {
+		log.Fatalf("Cannot export vars to %s: %s", glcli.Config.VarsFile, err)
+	}
 	log.Printf("Exit now because vars from %s env are copied to %s env", envfrom, envto)
 }
 
 func (glcli *GLCli) Bootstrap() {
-	var varExample gitlablib.GitlabVarData
-	var envExample gitlablib.GitlabEnvData
+	var varExample VarFileData
+	var envExample EnvFileData
 	varExample.Key = "VAR_KEY"
 	varExample.Value = "VAR_VALUE"
 	varExample.Env = "*"
 	varExample.IsRaw = true
 	varExample.Description = "Description of VAR_KEY"
-	glcli.vars.GitlabData = append(glcli.vars.GitlabData, varExample)
+	varExample.VariableType = varTypeEnv
 	envExample.Name = "ENV_NAME"
 	envExample.Description = "Description of ENV_NAME"
 	envExample.State = "available"
-	glcli.envs.GitlabData = append(glcli.envs.GitlabData, envExample)
+	envExample.Tier = "other"
+	envExample.AutoStopSetting = "always"
 	f, err := os.OpenFile(glcli.Config.VarsFile, os.O_RDONLY, 0644)
 	if err == nil {
 		log.Fatal("Cannot bootstrap because var file exists.")
@@ -332,24 +494,45 @@ func (glcli *GLCli) Bootstrap() {
 		}()
 	}
 
-	glcli.vars.ExportVars(glcli.Config.VarsFile)
-	glcli.envs.ExportEnvs(glcli.Config.EnvsFile)
+	err = ExportVarFile(glcli.Config.VarsFile, []VarFileData{varExample})
+	if err != nil {
+		log.Fatalf("Cannot export vars to %s: %s", glcli.Config.VarsFile, err)
+	}
+	err = ExportEnvFile(glcli.Config.EnvsFile, []EnvFileData{envExample})
+	if err != nil {
+		log.Fatalf("Cannot export envs to %s: %s", glcli.Config.EnvsFile, err)
+	}
 	log.Print("Exit now because bootstrap is done")
 }
 
 func (glcli *GLCli) Setup() {
-	glcli.token = gitlablib.ReadFromFile(glcli.Config.TokenFile, "token", glcli.Config.VerboseMode)
-	glcli.vars = gitlablib.NewGitlabVar(glcli.Config.GitlabUrl, glcli.token, glcli.Config.VerboseMode)
-	glcli.envs = gitlablib.NewGitlabEnv(glcli.Config.GitlabUrl, glcli.token, glcli.Config.VerboseMode)
+	token, source, err := glcli.getToken()
+	if err != nil {
+		log.Fatalf("Cannot get Gitlab token: %s", err)
+	}
+	glcli.token = token
 	glcli.projects = gitlablib.NewGitlabProject(glcli.Config.GitlabUrl, glcli.token, glcli.Config.VerboseMode)
+	glcli.initClients()
 
 	if glcli.Config.VerboseMode {
-		log.Printf("Get token from: %s", glcli.Config.TokenFile)
+		log.Printf("Get token from: %s", source)
 	}
+	glcli.Preflight()
 	if glcli.Config.DryrunMode {
 		glcli.projects.DryrunMode = glcli.Config.DryrunMode
+	}
+}
+
+// initClients creates the var, env and API clients with the token and the
+// configuration.
+func (glcli *GLCli) initClients() {
+	glcli.vars = gitlablib.NewGitlabVar(glcli.Config.GitlabUrl, glcli.token, glcli.Config.VerboseMode)
+	glcli.envs = gitlablib.NewGitlabEnv(glcli.Config.GitlabUrl, glcli.token, glcli.Config.VerboseMode)
+	glcli.client = NewGitlabClient(glcli.Config.GitlabUrl, glcli.token, glcli.Config.VerboseMode)
+	if glcli.Config.DryrunMode {
 		glcli.vars.DryrunMode = glcli.Config.DryrunMode
 		glcli.envs.DryrunMode = glcli.Config.DryrunMode
+		glcli.client.DryrunMode = glcli.Config.DryrunMode
 	}
 }
 
@@ -360,6 +543,10 @@ func (glcli *GLCli) ExportProjects() {
 		log.Fatal("Cannot fetch projects from gitlab")
 	}
 	glcli.projects.ExportProjects(glcli.Config.ProjectsFile)
+	err = FormatProjectFile(glcli.Config.ProjectsFile)
+	if err != nil {
+		log.Fatalf("Cannot format project file: %s", err)
+	}
 	log.Print("Exit now because project export is done")
 }
 
@@ -380,7 +567,7 @@ func (glcli *GLCli) AdminRun() {
 	}
 	if glcli.Config.ExportMode {
 		log.Printf("Export current Gitlab global vars to %s file", glcli.Config.GlobalVarsFile)
-		glcli.vars.ExportGlobalVars(glcli.Config.GlobalVarsFile)
+		glcli.exportVars(glcli.Config.GlobalVarsFile, glcli.vars.GitlabGlobalData, globalVarsPath())
 		// log.Printf("Export current Gitlab envs to %s file", glcli.Config.EnvsFile)
 		// glcli.envs.ExportEnvs(glcli.Config.EnvsFile)
 		log.Print("Exit now because export is done")
@@ -396,12 +583,17 @@ func (glcli *GLCli) AdminRun() {
 		log.Fatalln("Cannot close global var file (test)")
 	}
 
-	glcli.vars.ImportGlobalVars(glcli.Config.GlobalVarsFile)
+	globalvars := glcli.importVars(glcli.Config.GlobalVarsFile, true)
+	var hidden map[string]bool
+	glcli.vars.FileGlobalData, hidden = withHiddenValues("global var", globalvars, glcli.vars.GitlabGlobalData)
 
 	toAdd, toDelete, toUpdate := glcli.vars.CompareGlobalVar()
 	if glcli.Config.VerboseMode {
 		log.Print("Compare the group variables between those present on GitLab and those in variable file")
 	}
+	toUpdate = skipHiddenUpdates("global var", toUpdate, glcli.vars.GitlabGlobalData, hidden)
+	typeToUpdate := glcli.compareVarTypes("global var", globalvars, glcli.getVarTypes(globalVarsPath()))
+	typeToUpdate = skipHiddenTypeUpdates("global var", typeToUpdate, hidden)
 	if glcli.Config.DryrunMode {
 		log.Print("Exit now because dryrun mode is active")
 		return
@@ -424,6 +616,12 @@ func (glcli *GLCli) AdminRun() {
 	if len(toUpdate) == 0 {
 		log.Print("No global var to update")
 	}
+	for _, item := range typeToUpdate {
+		err = glcli.updateVarType(globalVarsPath(), item, false)
+		if err != nil {
+			log.Fatalf("Cannot update type of global var %s: %s", item.Key, err)
+		}
+	}
 	if len(toDelete) == 0 {
 		log.Print("No global var to delete")
 	}
@@ -441,8 +639,151 @@ func (glcli *GLCli) AdminRun() {
 	}
 }
 
+// GroupRun manages the vars of a group, without project. The group is given
+// by its id or its path.
+func (glcli *GLCli) GroupRun() {
+	if glcli.GroupId == "" {
+		glcli.GroupId = gitlablib.ReadFromFile(glcli.Config.GroupIdFile, "group Id", glcli.Config.VerboseMode)
+		if glcli.Config.VerboseMode {
+			log.Printf("Get GroupId: %s from %s file", glcli.GroupId, glcli.Config.GroupIdFile)
+		}
+	}
+	if glcli.GroupId == "" {
+		log.Fatal("Group-only mode requires a group id or path with the gid option or in group id file")
+	}
+	glcli.GroupId = glcli.resolveGroupId(glcli.GroupId)
+	if glcli.Config.VerboseMode {
+		log.Printf("Using groupId: %s", glcli.GroupId)
+	}
+	if glcli.Config.RecursiveMode {
+		glcli.RecursiveGroupRun()
+		return
+	}
+	glcli.syncGroup()
+}
+
+// syncGroup exports, or imports, the vars of the group.
+func (glcli *GLCli) syncGroup() {
+	glcli.summary = SyncSummary{}
+	glcli.vars.GroupId = glcli.GroupId
+
+	log.Printf("Fetching group vars from gitlab with URL %s", glcli.Config.GitlabUrl)
+	err := glcli.vars.GetGroupVarsFromGitlab()
+	if err != nil {
+		log.Fatal("Cannot fetch vars from gitlab group")
+	}
+	if glcli.Config.DebugMode {
+		glcli.debug()
+	}
+	if glcli.Config.ExportMode {
+		log.Printf("Export current Gitlab group vars to %s file", glcli.Config.GroupVarsFile)
+		glcli.exportVars(glcli.Config.GroupVarsFile, glcli.vars.GitlabGroupData, groupVarsPath(glcli.GroupId))
+		if glcli.exportRequested(glcli.Config.LabelsFile) {
+			log.Printf("Export current Gitlab group labels to %s file", glcli.Config.LabelsFile)
+			glcli.exportLabels("groups", glcli.GroupId, glcli.Config.LabelsFile)
+		}
+		log.Print("Exit now because export is done")
+		return
+	}
+	_, err = os.Stat(glcli.Config.GroupVarsFile)
+	if err != nil {
+		log.Fatal("Nothing to do because group var file cannot be found. You may create it with the export flag in command line.")
+	}
+	_, err = os.Stat(glcli.Config.LabelsFile)
+	if err == nil {
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the group labels between those present on GitLab and those in label file")
+		}
+		glcli.syncLabels("groups", glcli.GroupId, glcli.Config.LabelsFile)
+	}
+
+	groupvars := glcli.importVars(glcli.Config.GroupVarsFile, true)
+	var hidden map[string]bool
+	glcli.vars.FileGroupData, hidden = withHiddenValues("group var", groupvars, glcli.vars.GitlabGroupData)
+
+	if glcli.Config.VerboseMode {
+		log.Print("Compare the group variables between those present on GitLab and those in variable file")
+	}
+	toAdd, toDelete, toUpdate := glcli.vars.CompareGroupVar()
+	toUpdate = skipHiddenUpdates("group var", toUpdate, glcli.vars.GitlabGroupData, hidden)
+	typeToUpdate := glcli.compareVarTypes("group var", groupvars, glcli.getVarTypes(groupVarsPath(glcli.GroupId)))
+	typeToUpdate = skipHiddenTypeUpdates("group var", typeToUpdate, hidden)
+	pushes := countHiddenPushes("group var", toUpdate, glcli.vars.GitlabGroupData)
+	glcli.summary.GroupVars.count(len(toAdd), len(toUpdate)-pushes+len(typeToUpdate), len(toDelete), glcli.Config.DeleteMode)
+	glcli.summary.GroupVars.Hidden += pushes
+	if glcli.Config.DryrunMode {
+		log.Print("Exit now because dryrun mode is active")
+		return
+	}
+	for _, item := range toAdd {
+		err = glcli.vars.InsertGroupVar(item)
+		if err != nil {
+			log.Fatalf("Cannot insert group var %s", item.Key)
+		}
+	}
+	if len(toAdd) == 0 {
+		log.Print("No group var to insert")
+	}
+	for _, item := range toUpdate {
+		err = glcli.vars.UpdateGroupVar(item)
+		if err != nil {
+			log.Fatalf("Cannot update group var %s", item.Key)
+		}
+	}
+	if len(toUpdate) == 0 {
+		log.Print("No group var to update")
+	}
+	for _, item := range typeToUpdate {
+		err = glcli.updateVarType(groupVarsPath(glcli.GroupId), item, true)
+		if err != nil {
+			log.Fatalf("Cannot update type of group var %s: %s", item.Key, err)
+		}
+	}
+	if len(toDelete) == 0 {
+		log.Print("No group var to delete")
+	}
+	if glcli.Config.DeleteMode {
+		for _, item := range toDelete {
+			err = glcli.vars.DeleteGroupVar(item)
+			if err != nil {
+				log.Fatalf("Cannot delete group var %s", item.Key)
+			}
+		}
+	} else {
+		if len(toDelete) > 0 {
+			log.Printf("%d group var(s) may be deleted, but delete flag in command line is not set", len(toDelete))
+		}
+	}
+	log.Print("Exit")
+}
+
+// resolveGroupId returns the id of a group given by its id or its full path.
+func (glcli *GLCli) resolveGroupId(group string) string {
+	_, err := strconv.Atoi(group)
+	if err == nil {
+		return group
+	}
+	var data struct {
+		Id int `json:"id"`
+	}
+	err = glcli.client.Request(http.MethodGet, "groups/"+url.PathEscape(group), nil, &data)
+	if err != nil {
+		log.Fatalf("Cannot find group %s: %s", group, err)
+	}
+	if glcli.Config.VerboseMode {
+		log.Printf("Get groupId: %d from group path %s", data.Id, group)
+	}
+	return strconv.Itoa(data.Id)
+}
+
 func (glcli *GLCli) Run() {
+	glcli.resolveProject()
+	glcli.sync()
+}
 
+// resolveProject finds the project id, from the project file with the git
+// remote URL or from the id file, and the group id.
+func (glcli *GLCli) resolveProject() {
 	projectfile, err := os.OpenFile(glcli.Config.ProjectsFile, os.O_RDONLY, 0644)
 	if err == nil {
 		glcli.projects.ImportProjects(glcli.Config.ProjectsFile)
@@ -487,15 +828,44 @@ func (glcli *GLCli) Run() {
 			log.Printf("Get GroupId: %s from %s file", glcli.GroupId, glcli.Config.GroupIdFile)
 		}
 	}
+	if glcli.GroupId != "" {
+		glcli.GroupId = glcli.resolveGroupId(glcli.GroupId)
+	}
 	if glcli.Config.VerboseMode {
 		log.Printf("Using projectId: %s, groupId: %s", glcli.ProjectId, glcli.GroupId)
 	}
+}
+
+// exportRequested tells if a resource file is exported: when it already
+// exists, or when it is given by an option, an environment variable or the
+// fleet manifest. So an export does not fetch resources which are not managed
+// with glcli, which the token may not be allowed to read.
+func (glcli *GLCli) exportRequested(filename string) bool {
+	if filename == "" {
+		return false
+	}
+	_, err := os.Stat(filename)
+	if err == nil {
+		return true
+	}
+	if slices.Contains(glcli.Config.RequestedFiles, filename) {
+		return true
+	}
+	if glcli.Config.VerboseMode {
+		log.Printf("Skip export to %s file because it does not exist", filename)
+	}
+	return false
+}
+
+// sync exports, or imports, the vars, group vars and envs of the project.
+func (glcli *GLCli) sync() {
+	glcli.summary = SyncSummary{}
 	glcli.envs.ProjectId = glcli.ProjectId
 	glcli.vars.ProjectId = glcli.ProjectId
 	glcli.vars.GroupId = glcli.GroupId
 
 	log.Printf("Fetching envs from gitlab with URL %s", glcli.Config.GitlabUrl)
-	err = glcli.envs.GetEnvsFromGitlab()
+	err := glcli.envs.GetEnvsFromGitlab()
 	if err != nil {
 		log.Fatal("Cannot fetch envs from gitlab")
 	}
@@ -517,11 +887,49 @@ func (glcli *GLCli) Run() {
 
 	if glcli.Config.ExportMode {
 		log.Printf("Export current Gitlab vars to %s file", glcli.Config.VarsFile)
-		glcli.vars.ExportVars(glcli.Config.VarsFile)
-		log.Printf("Export current Gitlab group vars to %s file", glcli.Config.GroupVarsFile)
-		glcli.vars.ExportGroupVars(glcli.Config.GroupVarsFile)
+		glcli.exportVars(glcli.Config.VarsFile, glcli.vars.GitlabData, projectVarsPath(glcli.ProjectId))
+		if glcli.GroupId != "" {
+			log.Printf("Export current Gitlab group vars to %s file", glcli.Config.GroupVarsFile)
+			glcli.exportVars(glcli.Config.GroupVarsFile, glcli.vars.GitlabGroupData, groupVarsPath(glcli.GroupId))
+		}
 		log.Printf("Export current Gitlab envs to %s file", glcli.Config.EnvsFile)
-		glcli.envs.ExportEnvs(glcli.Config.EnvsFile)
+		envs := withEnvSettings(toEnvFileData(glcli.envs.GitlabData), glcli.getEnvSettings())
+		protected, available := glcli.getProtectedEnvs()
+		if available {
+			envs = withEnvProtections(envs, protected)
+		}
+		err = ExportEnvFile(glcli.Config.EnvsFile, envs)
+		if err != nil {
+			log.Fatalf("Cannot export envs to %s: %s", glcli.Config.EnvsFile, err)
+		}
+		if glcli.exportRequested(glcli.Config.SchedulesFile) {
+			log.Printf("Export current Gitlab pipeline schedules to %s file", glcli.Config.SchedulesFile)
+			glcli.exportSchedules(glcli.Config.SchedulesFile)
+		}
+		if glcli.exportRequested(glcli.Config.TriggersFile) {
+			log.Printf("Export current Gitlab pipeline triggers to %s file", glcli.Config.TriggersFile)
+			glcli.exportTriggers(glcli.Config.TriggersFile)
+		}
+		if glcli.exportRequested(glcli.Config.DeployFile) {
+			log.Printf("Export current Gitlab deploy tokens and keys to %s file", glcli.Config.DeployFile)
+			glcli.exportDeploy(glcli.Config.DeployFile)
+		}
+		if glcli.exportRequested(glcli.Config.ProtectedFile) {
+			log.Printf("Export current Gitlab protected branches and tags to %s file", glcli.Config.ProtectedFile)
+			glcli.exportProtected(glcli.Config.ProtectedFile)
+		}
+		if glcli.exportRequested(glcli.Config.CISettingsFile) {
+			log.Printf("Export current Gitlab CI settings to %s file", glcli.Config.CISettingsFile)
+			glcli.exportCISettings(glcli.Config.CISettingsFile)
+		}
+		if glcli.exportRequested(glcli.Config.HooksFile) {
+			log.Printf("Export current Gitlab hooks to %s file", glcli.Config.HooksFile)
+			glcli.exportHooks(glcli.Config.HooksFile)
+		}
+		if glcli.exportRequested(glcli.Config.LabelsFile) {
+			log.Printf("Export current Gitlab labels to %s file", glcli.Config.LabelsFile)
+			glcli.exportLabels("projects", glcli.ProjectId, glcli.Config.LabelsFile)
+		}
 		log.Print("Exit now because export is done")
 		return
 	}
@@ -537,8 +945,11 @@ func (glcli *GLCli) Run() {
 			log.Fatalln("Cannot close env file (test)")
 		}
 
-		glcli.envs.ImportEnvs(glcli.Config.EnvsFile)
+		// Env file is validated before any change, then used by each step
+		envs := glcli.readEnvFile()
+		glcli.envs.FileData = toGitlabEnvData(envs)
 		envToAdd, envToDelete, envToUpdate := glcli.envs.CompareEnv()
+		glcli.summary.Envs.count(len(envToAdd), len(envToUpdate), len(envToDelete), glcli.Config.DeleteMode)
 		for _, item := range envToAdd {
 			if !glcli.Config.DryrunMode {
 				err = glcli.envs.InsertEnv(item)
@@ -566,9 +977,10 @@ func (glcli *GLCli) Run() {
 		}
 		if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
 			for _, item := range envToDelete {
-				err = glcli.envs.DeleteEnv(item)
+				// Gitlab only deletes stopped envs
+				err = glcli.deleteEnv(EnvDetails{Id: item.Id, Name: item.Name, State: item.State})
 				if err != nil {
-					log.Fatalf("Cannot delete env %s", item.Name)
+					log.Fatalf("Cannot delete env %s: %s", item.Name, err)
 				}
 			}
 		} else {
@@ -576,6 +988,18 @@ func (glcli *GLCli) Run() {
 				log.Printf("%d env(s) may be deleted, but delete flag in command line is not set", len(envToDelete))
 			}
 		}
+		created := make([]string, 0, len(envToAdd))
+		for _, item := range envToAdd {
+			created = append(created, item.Name)
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the environment settings between those present on GitLab and those in environment file")
+		}
+		glcli.syncEnvSettings(envs, created)
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the environment protections between those present on GitLab and those in environment file")
+		}
+		glcli.syncEnvProtections(envs)
 	}
 	varfile, err := os.OpenFile(glcli.Config.VarsFile, os.O_RDONLY, 0644)
 	if err != nil {
@@ -586,14 +1010,95 @@ func (glcli *GLCli) Run() {
 	if err != nil {
 		log.Fatalln("Cannot close var file (test)")
 	}
+	schedulefile, err := os.OpenFile(glcli.Config.SchedulesFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = schedulefile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close schedule file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the pipeline schedules between those present on GitLab and those in schedule file")
+		}
+		glcli.syncSchedules(glcli.Config.SchedulesFile)
+	}
+	triggerfile, err := os.OpenFile(glcli.Config.TriggersFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = triggerfile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close trigger file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the pipeline triggers between those present on GitLab and those in trigger file")
+		}
+		glcli.syncTriggers(glcli.Config.TriggersFile)
+	}
+	deployfile, err := os.OpenFile(glcli.Config.DeployFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = deployfile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close deploy file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the deploy tokens and keys between those present on GitLab and those in deploy file")
+		}
+		glcli.syncDeploy(glcli.Config.DeployFile)
+	}
+	protectedfile, err := os.OpenFile(glcli.Config.ProtectedFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = protectedfile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close protected file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the protected branches and tags between those present on GitLab and those in protected file")
+		}
+		glcli.syncProtected(glcli.Config.ProtectedFile)
+	}
+	cisettingsfile, err := os.OpenFile(glcli.Config.CISettingsFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = cisettingsfile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close CI settings file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the CI settings between those present on GitLab and those in CI settings file")
+		}
+		glcli.syncCISettings(glcli.Config.CISettingsFile)
+	}
+	hookfile, err := os.OpenFile(glcli.Config.HooksFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = hookfile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close hook file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the hooks between those present on GitLab and those in hook file")
+		}
+		glcli.syncHookFile(glcli.Config.HooksFile)
+	}
+	labelfile, err := os.OpenFile(glcli.Config.LabelsFile, os.O_RDONLY, 0644)
+	if err == nil {
+		err = labelfile.Close()
+		if err != nil {
+			log.Fatalln("Cannot close label file (test)")
+		}
+		if glcli.Config.VerboseMode {
+			log.Print("Compare the labels between those present on GitLab and those in label file")
+		}
+		glcli.syncLabels("projects", glcli.ProjectId, glcli.Config.LabelsFile)
+	}
 	if glcli.Config.VerboseMode {
 		log.Print("Compare the environments between those present on GitLab and those in variable files")
 	}
 
-	glcli.vars.ImportVars(glcli.Config.VarsFile)
-	glcli.vars.ImportGroupVars(glcli.Config.GroupVarsFile)
+	projectvars := glcli.importVars(glcli.Config.VarsFile, true)
+	groupvars := glcli.importVars(glcli.Config.GroupVarsFile, false)
+	var hidden, groupHidden map[string]bool
+	glcli.vars.FileData, hidden = withHiddenValues("var", projectvars, glcli.vars.GitlabData)
+	glcli.vars.FileGroupData, groupHidden = withHiddenValues("group var", groupvars, glcli.vars.GitlabGroupData)
 
 	missingEnvs := glcli.envs.GetMissingEnvs(glcli.vars.GetEnvsFromVars())
+	glcli.summary.Envs.Add += len(missingEnvs)
 	for _, env := range missingEnvs {
 		if !glcli.Config.DryrunMode {
 			var newenv gitlablib.GitlabEnvData
@@ -616,6 +1121,24 @@ func (glcli *GLCli) Run() {
 		log.Print("Compare the group variables between those present on GitLab and those in variable file")
 	}
 	toGroupAdd, toGroupDelete, toGroupUpdate := glcli.vars.CompareGroupVar()
+	if glcli.groupSynced {
+		toGroupAdd, toGroupDelete, toGroupUpdate = nil, nil, nil
+	}
+	toUpdate = skipHiddenUpdates("var", toUpdate, glcli.vars.GitlabData, hidden)
+	toGroupUpdate = skipHiddenUpdates("group var", toGroupUpdate, glcli.vars.GitlabGroupData, groupHidden)
+	typeToUpdate := glcli.compareVarTypes("var", projectvars, glcli.getVarTypes(projectVarsPath(glcli.ProjectId)))
+	typeToUpdate = skipHiddenTypeUpdates("var", typeToUpdate, hidden)
+	var groupTypeToUpdate []VarFileData
+	if glcli.GroupId != "" && !glcli.groupSynced {
+		groupTypeToUpdate = glcli.compareVarTypes("group var", groupvars, glcli.getVarTypes(groupVarsPath(glcli.GroupId)))
+		groupTypeToUpdate = skipHiddenTypeUpdates("group var", groupTypeToUpdate, groupHidden)
+	}
+	pushes := countHiddenPushes("var", toUpdate, glcli.vars.GitlabData)
+	groupPushes := countHiddenPushes("group var", toGroupUpdate, glcli.vars.GitlabGroupData)
+	glcli.summary.Vars.count(len(toAdd), len(toUpdate)-pushes+len(typeToUpdate), len(toDelete), glcli.Config.DeleteMode)
+	glcli.summary.Vars.Hidden += pushes
+	glcli.summary.GroupVars.count(len(toGroupAdd), len(toGroupUpdate)-groupPushes+len(groupTypeToUpdate), len(toGroupDelete), glcli.Config.DeleteMode)
+	glcli.summary.GroupVars.Hidden += groupPushes
 	if glcli.Config.DryrunMode {
 		log.Print("Exit now because dryrun mode is active")
 		return
@@ -638,6 +1161,12 @@ func (glcli *GLCli) Run() {
 	if len(toUpdate) == 0 {
 		log.Print("No var to update")
 	}
+	for _, item := range typeToUpdate {
+		err = glcli.updateVarType(projectVarsPath(glcli.ProjectId), item, true)
+		if err != nil {
+			log.Fatalf("Cannot update type of var %s: %s", item.Key, err)
+		}
+	}
 	if len(toDelete) == 0 {
 		log.Print("No var to delete")
 	}
@@ -671,6 +1200,12 @@ func (glcli *GLCli) Run() {
 	if len(toGroupUpdate) == 0 {
 		log.Print("No group var to update")
 	}
+	for _, item := range groupTypeToUpdate {
+		err = glcli.updateVarType(groupVarsPath(glcli.GroupId), item, true)
+		if err != nil {
+			log.Fatalf("Cannot update type of group var %s: %s", item.Key, err)
+		}
+	}
 	if len(toGroupDelete) == 0 {
 		log.Print("No group var to delete")
 	}
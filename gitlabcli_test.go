@@ -1,7 +1,11 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/didier13150/gitlablib"
@@ -207,3 +211,98 @@ func TestGLCliRun(t *testing.T) {
 		t.Errorf(`TestGLCliExport(delete env export file) = %s`, err)
 	}
 }
+
+func TestGLCliResolveGroupId(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/groups/infra%2Fplatform" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 42, "full_path": "infra/platform"}`))
+	}))
+	defer server.Close()
+	glcli := GLCli{}
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	if id := glcli.resolveGroupId("7"); id != "7" {
+		t.Errorf(`TestGLCliResolveGroupId(numeric id) = %s, want %s`, id, "7")
+	}
+	if id := glcli.resolveGroupId("infra/platform"); id != "42" {
+		t.Errorf(`TestGLCliResolveGroupId(group path) = %s, want %s`, id, "42")
+	}
+}
+
+func TestGLCliSyncGroup(t *testing.T) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			writes = append(writes, r.Method+" "+r.URL.Path)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if r.URL.Path == "/api/v4/groups/7/labels" {
+			_, _ = w.Write([]byte(`[{"id": 1, "name": "bug", "color": "#FF0000", "description": ""},
+{"id": 2, "name": "obsolete", "color": "#000000", "description": ""}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	glcli := GLCli{}
+	glcli.Config.GitlabUrl = server.URL
+	glcli.Config.GroupVarsFile = filepath.Join(dir, "group-vars.json")
+	glcli.Config.LabelsFile = filepath.Join(dir, "labels.json")
+	glcli.Config.DeleteMode = true
+	glcli.GroupId = "7"
+	glcli.token = "token"
+	err := os.WriteFile(glcli.Config.LabelsFile, []byte(`[{"name": "bug", "color": "#FF0000", "description": ""},
+{"name": "feature", "color": "#00FF00", "description": ""}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(glcli.Config.GroupVarsFile, []byte(`[]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	glcli.Config.DryrunMode = true
+	glcli.initClients()
+	glcli.syncGroup()
+	if len(writes) != 0 {
+		t.Errorf(`TestGLCliSyncGroup(dryrun requests) = %v, want none`, writes)
+	}
+	if glcli.summary.Labels != (ChangeCount{Add: 1, Delete: 1}) {
+		t.Errorf(`TestGLCliSyncGroup(dryrun labels) = %s, want %s`, glcli.summary.Labels, ChangeCount{Add: 1, Delete: 1})
+	}
+
+	glcli.Config.DryrunMode = false
+	glcli.initClients()
+	glcli.syncGroup()
+	want := []string{"POST /api/v4/groups/7/labels", "DELETE /api/v4/groups/7/labels/2"}
+	if strings.Join(writes, ", ") != strings.Join(want, ", ") {
+		t.Errorf(`TestGLCliSyncGroup(requests) = %v, want %v`, writes, want)
+	}
+}
+
+func TestGLCliExportRequested(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "labels.json")
+	err := os.WriteFile(existing, []byte(`[]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.Config.RequestedFiles = []string{filepath.Join(dir, "hooks.json")}
+	tests := map[string]bool{
+		"":                                false,
+		existing:                          true,
+		filepath.Join(dir, "hooks.json"):  true,
+		filepath.Join(dir, "deploy.json"): false,
+	}
+	for filename, want := range tests {
+		if got := glcli.exportRequested(filename); got != want {
+			t.Errorf(`TestGLCliExportRequested(%s) = %t, want %t`, filename, got, want)
+		}
+	}
+}
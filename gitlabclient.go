@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GitlabClient is a minimal Gitlab REST API client used for the resources and
+// attributes which are not handled by gitlablib.
+type GitlabClient struct {
+	Url         string
+	Token       string
+	VerboseMode bool
+	DryrunMode  bool
+	httpClient  *http.Client
+}
+
+func NewGitlabClient(url string, token string, verbose bool) GitlabClient {
+	client := GitlabClient{}
+	client.Url = strings.TrimSuffix(url, "/")
+	client.Token = token
+	client.VerboseMode = verbose
+	client.DryrunMode = false
+	client.httpClient = &http.Client{Timeout: 30 * time.Second}
+	return client
+}
+
+// Request calls the API path (relative to /api/v4/) with the JSON encoded body
+// and decodes the JSON response in result. Body and result can be nil.
+func (client *GitlabClient) Request(method string, path string, body any, result any) error {
+	_, err := client.request(method, path, body, result)
+	return err
+}
+
+// GetAll fetches all pages of a list API path and decodes them in result, which
+// must be a pointer to a slice.
+func (client *GitlabClient) GetAll(path string, result any) error {
+	var items []json.RawMessage
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	page := "1"
+	for page != "" {
+		var pageItems []json.RawMessage
+		header, err := client.request(http.MethodGet, fmt.Sprintf("%s%sper_page=100&page=%s", path, separator, page), nil, &pageItems)
+		if err != nil {
+			return err
+		}
+		items = append(items, pageItems...)
+		page = header.Get("X-Next-Page")
+	}
+	if items == nil {
+		items = []json.RawMessage{}
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (client *GitlabClient) request(method string, path string, body any, result any) (http.Header, error) {
+	url := client.Url + "/api/v4/" + strings.TrimPrefix(path, "/")
+	if client.VerboseMode {
+		log.Printf("Use URL %s with %s method", url, method)
+	}
+	if client.DryrunMode && method != http.MethodGet && method != http.MethodHead {
+		log.Printf("Skip %s request on %s because dryrun mode is active", method, url)
+		return http.Header{}, nil
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(tokenHeaderPrivate, client.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if client.httpClient == nil {
+		client.httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println("Cannot close response body", err)
+		}
+	}()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &GitlabError{Method: method, Url: url, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	if result != nil && len(data) > 0 {
+		err = json.Unmarshal(data, result)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode response of %s %s: %w", method, url, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// GitlabError is returned when the Gitlab API answers with a non 2xx status.
+type GitlabError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Message    string
+}
+
+func (err *GitlabError) Error() string {
+	return fmt.Sprintf("%s %s returns %d: %s", err.Method, err.Url, err.StatusCode, err.Message)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// recorder records the requests received by a Gitlab test server, as
+// "<method> <path>", with the JSON body of the requests which change data.
+type recorder struct {
+	requests []string
+	bodies   map[string]map[string]any
+	// status gives the status of a request which changes data, 200 when nil
+	status func(request string, body map[string]any) int
+}
+
+// writes returns the requests which change data, sorted.
+func (rec *recorder) writes() []string {
+	var writes []string
+	for _, request := range rec.requests {
+		if !strings.HasPrefix(request, http.MethodGet+" ") {
+			writes = append(writes, request)
+		}
+	}
+	sort.Strings(writes)
+	return writes
+}
+
+// reset forgets the recorded requests.
+func (rec *recorder) reset() {
+	rec.requests = nil
+	rec.bodies = make(map[string]map[string]any)
+}
+
+// expectWrites checks that the requests which change data are the wanted
+// ones, in any order, then forgets the recorded requests. check names the
+// check in the error, as TestName(what).
+func (rec *recorder) expectWrites(t *testing.T, check string, want []string) {
+	t.Helper()
+	writes := rec.writes()
+	sorted := slices.Clone(want)
+	sort.Strings(sorted)
+	if strings.Join(writes, ", ") != strings.Join(sorted, ", ") {
+		t.Errorf(`%s = %v, want %v`, check, writes, sorted)
+	}
+	rec.reset()
+}
+
+// newRecordingServer starts a Gitlab test server which answers requests,
+// given as "<method> <path>", with their JSON response. Other GET requests are
+// not found and other requests get an empty object.
+func newRecordingServer(t *testing.T, responses map[string]string) (*httptest.Server, *recorder) {
+	rec := &recorder{}
+	rec.reset()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.Method + " " + r.URL.Path
+		rec.requests = append(rec.requests, request)
+		w.Header().Set("Content-Type", "application/json")
+		response, found := responses[request]
+		if r.Method == http.MethodGet {
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				response = `{"message": "404 Not found"}`
+			}
+			_, _ = w.Write([]byte(response))
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		rec.bodies[request] = body
+		if rec.status != nil {
+			w.WriteHeader(rec.status(request, body))
+		}
+		if !found {
+			response = `{}`
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, rec
+}
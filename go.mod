@@ -3,12 +3,15 @@ module github.com/didier13150/gitlabcli
 go 1.21.0
 
 require (
+	filippo.io/age v1.2.1
 	github.com/didier13150/gitlablib v0.2.0
 	gopkg.in/ini.v1 v1.67.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/didier13150/gitlablib"
+)
+
+// Gitlab never returns the value of hidden vars, they are exported with this
+// placeholder value.
+const hiddenValue = "<hidden>"
+
+// hasHiddenValue tells if a var is a hidden var without value in the var
+// file: the value is the placeholder or is empty, which Gitlab does not
+// allow for hidden vars.
+func hasHiddenValue(item VarFileData) bool {
+	return item.IsHidden && (item.Value == hiddenValue || item.Value == "")
+}
+
+// withHiddenValues returns the Gitlab data of var file entries. Hidden vars
+// without value in the var file take their value on Gitlab, so their value
+// is not compared, and those which do not exist on Gitlab are skipped because
+// they cannot be created without value. The ids of hidden vars without value
+// are returned.
+func withHiddenValues(label string, data []VarFileData, gitlab []gitlablib.GitlabVarData) ([]gitlablib.GitlabVarData, map[string]bool) {
+	current := make(map[string]gitlablib.GitlabVarData)
+	for _, item := range gitlab {
+		current[varId(item.Key, item.Env)] = item
+	}
+	hidden := make(map[string]bool)
+	vars := make([]gitlablib.GitlabVarData, 0, len(data))
+	for _, item := range data {
+		if hasHiddenValue(item) {
+			id := varId(item.Key, item.Env)
+			old, found := current[id]
+			if !found {
+				log.Printf("Skip hidden %s %s (%s) because it cannot be created without value", label, item.Key, item.Env)
+				continue
+			}
+			hidden[id] = true
+			item.Value = old.Value
+		}
+		vars = append(vars, item.GitlabVarData)
+	}
+	return vars, hidden
+}
+
+// varChanges returns the attributes of a var which differ between Gitlab and
+// the var file.
+func varChanges(old gitlablib.GitlabVarData, item gitlablib.GitlabVarData) []string {
+	var changes []string
+	if old.Value != item.Value {
+		changes = append(changes, "value")
+	}
+	if old.Description != item.Description {
+		changes = append(changes, "description")
+	}
+	if old.IsRaw != item.IsRaw {
+		changes = append(changes, "raw")
+	}
+	if old.IsHidden != item.IsHidden {
+		changes = append(changes, "hidden")
+	}
+	if old.IsProtected != item.IsProtected {
+		changes = append(changes, "protected")
+	}
+	if old.IsMasked != item.IsMasked {
+		changes = append(changes, "masked")
+	}
+	return changes
+}
+
+func varsById(gitlab []gitlablib.GitlabVarData) map[string]gitlablib.GitlabVarData {
+	current := make(map[string]gitlablib.GitlabVarData)
+	for _, item := range gitlab {
+		current[varId(item.Key, item.Env)] = item
+	}
+	return current
+}
+
+// skipHiddenUpdates removes hidden vars without value from vars to update:
+// Gitlab requires the value to update a var, and the value in Gitlab would be
+// overwritten. Each skipped change is logged.
+func skipHiddenUpdates(label string, toUpdate []gitlablib.GitlabVarData, gitlab []gitlablib.GitlabVarData, hidden map[string]bool) []gitlablib.GitlabVarData {
+	var kept []gitlablib.GitlabVarData
+	current := varsById(gitlab)
+	for _, item := range toUpdate {
+		if hidden[varId(item.Key, item.Env)] {
+			changes := varChanges(current[varId(item.Key, item.Env)], item)
+			log.Printf("Skip update of hidden %s %s (%s) because its value is not in var file, changes are lost: %s", label, item.Key, item.Env, strings.Join(changes, ", "))
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// countHiddenPushes returns the number of hidden vars to update whose value
+// is the only change. Gitlab never returns the value of hidden vars, so a
+// hidden var with a value in the var file is pushed on each run even when it
+// is unchanged.
+func countHiddenPushes(label string, toUpdate []gitlablib.GitlabVarData, gitlab []gitlablib.GitlabVarData) int {
+	pushes := 0
+	current := varsById(gitlab)
+	for _, item := range toUpdate {
+		old, found := current[varId(item.Key, item.Env)]
+		if !found || !old.IsHidden || !item.IsHidden {
+			continue
+		}
+		changes := varChanges(old, item)
+		if len(changes) == 1 && changes[0] == "value" {
+			log.Printf("Push value of hidden %s %s (%s) because Gitlab never returns it", label, item.Key, item.Env)
+			pushes++
+		}
+	}
+	return pushes
+}
+
+// skipHiddenTypeUpdates removes hidden vars without value from vars whose
+// type must be updated.
+func skipHiddenTypeUpdates(label string, toUpdate []VarFileData, hidden map[string]bool) []VarFileData {
+	var kept []VarFileData
+	for _, item := range toUpdate {
+		if hidden[varId(item.Key, item.Env)] {
+			log.Printf("Skip type update of hidden %s %s (%s) because its value is not in var file", label, item.Key, item.Env)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/didier13150/gitlablib"
+)
+
+func TestHiddenValues(t *testing.T) {
+	var exported, provided, missing VarFileData
+	exported.Key = "TOKEN"
+	exported.Env = "*"
+	exported.Value = hiddenValue
+	exported.IsHidden = true
+	exported.Description = "New description"
+	provided.Key = "PASSWORD"
+	provided.Env = "*"
+	provided.Value = "n3w-p4ssw0rd"
+	provided.IsHidden = true
+	missing.Key = "MISSING"
+	missing.Env = "*"
+	missing.Value = hiddenValue
+	missing.IsHidden = true
+
+	gitlab := []gitlablib.GitlabVarData{exported.GitlabVarData, provided.GitlabVarData}
+	gitlab[0].Value = ""
+	gitlab[0].Description = ""
+	gitlab[1].Value = ""
+	vars, hidden := withHiddenValues("var", []VarFileData{exported, provided, missing}, gitlab)
+	if len(vars) != 2 {
+		t.Fatalf(`TestHiddenValues(count vars) = %d, want %d`, len(vars), 2)
+	}
+	if vars[0].Value != "" {
+		t.Errorf(`TestHiddenValues(value of placeholder var) = %q, want empty`, vars[0].Value)
+	}
+	if vars[1].Value != "n3w-p4ssw0rd" {
+		t.Errorf(`TestHiddenValues(provided value) = %q, want %q`, vars[1].Value, "n3w-p4ssw0rd")
+	}
+	if !hidden[varId("TOKEN", "*")] || hidden[varId("PASSWORD", "*")] {
+		t.Errorf(`TestHiddenValues(hidden ids) = %v, want only %s`, hidden, varId("TOKEN", "*"))
+	}
+
+	toUpdate := skipHiddenUpdates("var", vars, gitlab, hidden)
+	if len(toUpdate) != 1 || toUpdate[0].Key != "PASSWORD" {
+		t.Errorf(`TestHiddenValues(vars to update) = %v, want only PASSWORD`, toUpdate)
+	}
+	pushes := countHiddenPushes("var", toUpdate, gitlab)
+	if pushes != 1 {
+		t.Errorf(`TestHiddenValues(hidden pushes) = %d, want %d`, pushes, 1)
+	}
+	toUpdate[0].Description = "New description"
+	pushes = countHiddenPushes("var", toUpdate, gitlab)
+	if pushes != 0 {
+		t.Errorf(`TestHiddenValues(hidden pushes with a new description) = %d, want %d`, pushes, 0)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+)
+
+// Events of webhooks, set by the <event>_events attributes of Gitlab API.
+var hookEvents = []string{"push", "tag_push", "issues", "confidential_issues", "merge_requests", "note", "confidential_note", "job", "pipeline", "wiki_page", "deployment", "releases"}
+
+// Hook is a webhook of hook file, matched by URL. Its secret token is given
+// by a value reference and is never written in this file, as Gitlab does not
+// return it. SSL verification is enabled by default, as on Gitlab.
+type Hook struct {
+	Url                   string   `json:"url"`
+	Events                []string `json:"events"`
+	EnableSslVerification bool     `json:"enable_ssl_verification"`
+	TokenRef              string   `json:"token_ref,omitempty"`
+}
+
+func (hook *Hook) UnmarshalJSON(data []byte) error {
+	type plain Hook
+	item := plain{EnableSslVerification: true}
+	err := json.Unmarshal(data, &item)
+	*hook = Hook(item)
+	return err
+}
+
+// HookData is the content of hook file. Group hooks are only managed when
+// the group_hooks key is present, as they are shared by all projects of the
+// group.
+type HookData struct {
+	Hooks      []Hook  `json:"hooks"`
+	GroupHooks *[]Hook `json:"group_hooks,omitempty"`
+}
+
+// groupHooks returns the group hooks, nil when they are not managed.
+func (data HookData) groupHooks() []Hook {
+	if data.GroupHooks == nil {
+		return nil
+	}
+	return *data.GroupHooks
+}
+
+// GitlabHook is a webhook as returned by Gitlab API. Events are read from the
+// <event>_events attributes.
+type GitlabHook struct {
+	Id int
+	Hook
+}
+
+func (hook *GitlabHook) UnmarshalJSON(data []byte) error {
+	var item struct {
+		Id                    int    `json:"id"`
+		Url                   string `json:"url"`
+		EnableSslVerification bool   `json:"enable_ssl_verification"`
+	}
+	var attributes map[string]any
+	err := json.Unmarshal(data, &item)
+	if err == nil {
+		err = json.Unmarshal(data, &attributes)
+	}
+	if err != nil {
+		return err
+	}
+	*hook = GitlabHook{Id: item.Id, Hook: Hook{Url: item.Url, EnableSslVerification: item.EnableSslVerification, Events: []string{}}}
+	for _, event := range hookEvents {
+		if attributes[event+"_events"] == true {
+			hook.Events = append(hook.Events, event)
+		}
+	}
+	return nil
+}
+
+// HookUpdate is a webhook to update with its Gitlab webhook.
+type HookUpdate struct {
+	Hook
+	Current GitlabHook
+}
+
+// normalized returns the hook with sorted events.
+func (hook Hook) normalized() Hook {
+	hook.Events = slices.Clone(hook.Events)
+	sort.Strings(hook.Events)
+	hook.Events = slices.Compact(hook.Events)
+	return hook
+}
+
+// Equal tells if both hooks have the same events and SSL verification. The
+// token reference is not compared, as Gitlab does not return the token.
+func (hook Hook) Equal(other Hook) bool {
+	return slices.Equal(hook.normalized().Events, other.normalized().Events) && hook.EnableSslVerification == other.EnableSslVerification
+}
+
+// ImportHookFile reads a hook file and checks that URLs are given and unique
+// and that events are known.
+func ImportHookFile(filename string) (HookData, error) {
+	var data HookData
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return data, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	for _, hooks := range [][]Hook{data.Hooks, data.groupHooks()} {
+		seen := make(map[string]bool)
+		for idx, item := range hooks {
+			if item.Url == "" {
+				return data, fmt.Errorf("hook %d of %s has no URL", idx+1, filename)
+			}
+			if seen[item.Url] {
+				return data, fmt.Errorf("hook %s is defined twice in %s", item.Url, filename)
+			}
+			seen[item.Url] = true
+			for _, event := range item.Events {
+				if !slices.Contains(hookEvents, event) {
+					return data, fmt.Errorf("unknown event %s of hook %s in %s (must be one of %v)", event, item.Url, filename, hookEvents)
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// ExportHookFile writes hooks to filename, sorted by URL.
+func ExportHookFile(filename string, data HookData) error {
+	sorted := HookData{Hooks: sortedHooks(data.Hooks)}
+	if data.GroupHooks != nil {
+		groupHooks := sortedHooks(*data.GroupHooks)
+		sorted.GroupHooks = &groupHooks
+	}
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+func sortedHooks(hooks []Hook) []Hook {
+	sorted := make([]Hook, 0, len(hooks))
+	for _, item := range hooks {
+		sorted = append(sorted, item.normalized())
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Url < sorted[j].Url
+	})
+	return sorted
+}
+
+// CompareHooks compares the hooks of hook file with the Gitlab ones. With
+// setTokens, hooks which have a token reference are updated to set their
+// token, as a token change cannot be seen.
+func CompareHooks(data []Hook, gitlab []GitlabHook, setTokens bool) ([]Hook, []HookUpdate, []GitlabHook, error) {
+	var toAdd []Hook
+	var toUpdate []HookUpdate
+	var toDelete []GitlabHook
+	current := make(map[string]GitlabHook)
+	for _, item := range gitlab {
+		if _, found := current[item.Url]; found {
+			return nil, nil, nil, fmt.Errorf("several Gitlab hooks use URL %s", item.Url)
+		}
+		current[item.Url] = item
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Url] = true
+		hook, found := current[item.Url]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if !item.Equal(hook.Hook) || (setTokens && item.TokenRef != "") {
+			toUpdate = append(toUpdate, HookUpdate{Hook: item, Current: hook})
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Url] {
+			toDelete = append(toDelete, item)
+		}
+	}
+	return toAdd, toUpdate, toDelete, nil
+}
+
+// withTokenRefs returns hooks with the token references of the previous
+// hooks.
+func withTokenRefs(hooks []Hook, previous []Hook) []Hook {
+	refs := make(map[string]string)
+	for _, item := range previous {
+		refs[item.Url] = item.TokenRef
+	}
+	for idx := range hooks {
+		hooks[idx].TokenRef = refs[hooks[idx].Url]
+	}
+	return hooks
+}
+
+// hookBody returns the attributes of a hook for Gitlab API. Every known
+// event is given, so events removed from the file are disabled.
+func hookBody(item Hook, token string) map[string]any {
+	body := map[string]any{
+		"url":                     item.Url,
+		"enable_ssl_verification": item.EnableSslVerification,
+	}
+	for _, event := range hookEvents {
+		body[event+"_events"] = slices.Contains(item.Events, event)
+	}
+	if token != "" {
+		body["token"] = token
+	}
+	return body
+}
+
+func hooksPath(kind string, id string) string {
+	return kind + "/" + url.PathEscape(id) + "/hooks"
+}
+
+// getHooks returns the hooks of a project or a group.
+func (glcli *GLCli) getHooks(path string) []GitlabHook {
+	var data []GitlabHook
+	err := glcli.client.GetAll(path, &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch hooks from gitlab: %s", err)
+	}
+	return data
+}
+
+// exportHooks writes the hooks of the project in filename. The hooks of its
+// group are only written when the previous hook file manages them. Token
+// references of the previous hook file are kept, tokens are never written.
+// The file is only written when there is a hook or when it exists.
+func (glcli *GLCli) exportHooks(filename string) {
+	previous, err := ImportHookFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Cannot read previous hook file: %s", err)
+	}
+	var data HookData
+	for _, item := range glcli.getHooks(hooksPath("projects", glcli.ProjectId)) {
+		data.Hooks = append(data.Hooks, item.Hook)
+	}
+	data.Hooks = withTokenRefs(data.Hooks, previous.Hooks)
+	if previous.GroupHooks != nil && glcli.GroupId != "" {
+		groupHooks := []Hook{}
+		for _, item := range glcli.getHooks(hooksPath("groups", glcli.GroupId)) {
+			groupHooks = append(groupHooks, item.Hook)
+		}
+		groupHooks = withTokenRefs(groupHooks, *previous.GroupHooks)
+		data.GroupHooks = &groupHooks
+	}
+	if len(data.Hooks) == 0 && errors.Is(err, os.ErrNotExist) {
+		if glcli.Config.VerboseMode {
+			log.Printf("No hook to export in %s file", filename)
+		}
+		return
+	}
+	err = ExportHookFile(filename, data)
+	if err != nil {
+		log.Fatalf("Cannot export hooks to %s: %s", filename, err)
+	}
+}
+
+// resolveHookTokens returns the tokens of hooks of the hook file filename by
+// URL. All references are resolved, and each failure is reported, before an
+// error is returned.
+func (glcli *GLCli) resolveHookTokens(label string, filename string, hooks []Hook) (map[string]string, error) {
+	tokens := make(map[string]string)
+	failures := 0
+	for _, item := range hooks {
+		if item.TokenRef == "" {
+			continue
+		}
+		token, err := glcli.getResolver().Resolve(fileRef(filename, item.TokenRef))
+		if err != nil {
+			log.Printf("Cannot resolve token of %s %s from %s: %s", label, item.Url, item.TokenRef, err)
+			failures++
+		}
+		tokens[item.Url] = token
+	}
+	if failures > 0 {
+		return nil, fmt.Errorf("%d token reference(s) cannot be resolved", failures)
+	}
+	return tokens, nil
+}
+
+// syncHooks applies hooks on a project or a group. Hooks missing in the file
+// are only deleted in delete mode.
+func (glcli *GLCli) syncHooks(label string, path string, filename string, data []Hook) {
+	toAdd, toUpdate, toDelete, err := CompareHooks(data, glcli.getHooks(path), glcli.Config.SetHookTokens)
+	if err != nil {
+		log.Fatalf("Cannot compare %ss: %s", label, err)
+	}
+	changed := slices.Clone(toAdd)
+	for _, item := range toUpdate {
+		changed = append(changed, item.Hook)
+	}
+	tokens, err := glcli.resolveHookTokens(label, filename, changed)
+	if err != nil {
+		log.Fatalf("Cannot apply %ss: %s", label, err)
+	}
+	glcli.summary.Hooks.count(len(toAdd), len(toUpdate), len(toDelete), glcli.Config.DeleteMode)
+	for _, item := range toAdd {
+		log.Printf("Hook %s should be created", item.Url)
+		if !glcli.Config.DryrunMode {
+			err = glcli.client.Request(http.MethodPost, path, hookBody(item, tokens[item.Url]), nil)
+			if err != nil {
+				log.Fatalf("Cannot create %s %s: %s", label, item.Url, err)
+			}
+		}
+	}
+	if len(toAdd) == 0 {
+		log.Printf("No %s to insert", label)
+	}
+	for _, item := range toUpdate {
+		log.Printf("Hook %s should be updated", item.Url)
+		if !glcli.Config.DryrunMode {
+			err = glcli.client.Request(http.MethodPut, fmt.Sprintf("%s/%d", path, item.Current.Id), hookBody(item.Hook, tokens[item.Url]), nil)
+			if err != nil {
+				log.Fatalf("Cannot update %s %s: %s", label, item.Url, err)
+			}
+		}
+	}
+	if len(toUpdate) == 0 {
+		log.Printf("No %s to update", label)
+	}
+	if len(toDelete) == 0 {
+		log.Printf("No %s to delete", label)
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, item := range toDelete {
+			err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", path, item.Id), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot delete %s %s: %s", label, item.Url, err)
+			}
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d %s(s) may be deleted, but delete flag in command line is not set", len(toDelete), label)
+	}
+}
+
+// syncHookFile applies the hook file on the project, and on its group when
+// the file manages group hooks.
+func (glcli *GLCli) syncHookFile(filename string) {
+	data, err := ImportHookFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import hook file: %s", err)
+	}
+	glcli.syncHooks("hook", hooksPath("projects", glcli.ProjectId), filename, data.Hooks)
+	if data.GroupHooks == nil {
+		if glcli.Config.VerboseMode {
+			log.Print("Group hooks are not managed by hook file")
+		}
+	} else if glcli.groupSynced {
+		log.Print("Skip group hooks because group is already synced")
+	} else if glcli.GroupId != "" {
+		glcli.syncHooks("group hook", hooksPath("groups", glcli.GroupId), filename, *data.GroupHooks)
+	} else if len(*data.GroupHooks) > 0 {
+		log.Fatal("Cannot apply group hooks because group id is unknown")
+	}
+}
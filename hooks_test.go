@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportHookFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		`{"hooks": [{"url": "https://ci.example.com/hook", "events": ["push", "merge_requests"], "token_ref": "env:HOOK_TOKEN"}], "group_hooks": []}`: true,
+		`{"hooks": [{"events": ["push"]}]}`:                                                                            false,
+		`{"hooks": [{"url": "https://ci.example.com/hook", "events": ["merge_request"]}]}`:                             false,
+		`{"hooks": [{"url": "https://ci.example.com/hook"}, {"url": "https://ci.example.com/hook"}]}`:                  false,
+		`{"hooks": [{"url": "https://ci.example.com/hook"}], "group_hooks": [{"url": "https://ci.example.com/hook"}]}`: true,
+	}
+	for content, valid := range tests {
+		filename := filepath.Join(dir, "hooks.json")
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ImportHookFile(filename)
+		if (err == nil) != valid {
+			t.Errorf(`TestImportHookFile(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+
+	filename := filepath.Join(dir, "hooks.json")
+	err := os.WriteFile(filename, []byte(`{"hooks": [{"url": "https://ci.example.com/hook", "events": ["push"]}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ImportHookFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.Hooks[0].EnableSslVerification {
+		t.Errorf(`TestImportHookFile(SSL verification default) = false, want true`)
+	}
+}
+
+func TestCompareHooks(t *testing.T) {
+	var gitlab []GitlabHook
+	err := json.Unmarshal([]byte(`[
+		{"id": 1, "url": "https://ci.example.com/hook", "push_events": true, "merge_requests_events": true, "tag_push_events": false, "enable_ssl_verification": true},
+		{"id": 2, "url": "https://chat.example.com/hook", "pipeline_events": true, "enable_ssl_verification": true},
+		{"id": 3, "url": "https://old.example.com/hook", "push_events": true, "enable_ssl_verification": false}
+	]`), &gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(gitlab[0].Events, ",") != "push,merge_requests" {
+		t.Errorf(`TestCompareHooks(Gitlab events) = %v, want push and merge_requests`, gitlab[0].Events)
+	}
+	data := []Hook{
+		{Url: "https://ci.example.com/hook", Events: []string{"merge_requests", "push"}, EnableSslVerification: true, TokenRef: "env:CI_HOOK_TOKEN"},
+		{Url: "https://chat.example.com/hook", Events: []string{"pipeline", "deployment"}, EnableSslVerification: true},
+		{Url: "https://audit.example.com/hook", Events: []string{"push"}, EnableSslVerification: true},
+	}
+	toAdd, toUpdate, toDelete, err := CompareHooks(data, gitlab, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toAdd) != 1 || toAdd[0].Url != "https://audit.example.com/hook" {
+		t.Errorf(`TestCompareHooks(hooks to add) = %v, want only audit hook`, toAdd)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].Current.Id != 2 {
+		t.Errorf(`TestCompareHooks(hooks to update) = %v, want only chat hook`, toUpdate)
+	}
+	if len(toDelete) != 1 || toDelete[0].Id != 3 {
+		t.Errorf(`TestCompareHooks(hooks to delete) = %v, want only old hook`, toDelete)
+	}
+
+	_, toUpdate, _, err = CompareHooks(data, gitlab, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toUpdate) != 2 {
+		t.Errorf(`TestCompareHooks(hooks to update with tokens) = %v, want ci and chat hooks`, toUpdate)
+	}
+
+	_, _, _, err = CompareHooks(data, append(gitlab, GitlabHook{Id: 4, Hook: Hook{Url: "https://ci.example.com/hook"}}), false)
+	if err == nil {
+		t.Errorf(`TestCompareHooks(duplicate Gitlab URL) = nil, want error`)
+	}
+}
+
+func TestHookBody(t *testing.T) {
+	body := hookBody(Hook{Url: "https://ci.example.com/hook", Events: []string{"push"}, EnableSslVerification: true}, "")
+	if body["push_events"] != true || body["tag_push_events"] != false {
+		t.Errorf(`TestHookBody(events) = %v, want only push events`, body)
+	}
+	if _, found := body["token"]; found {
+		t.Errorf(`TestHookBody(token) = %v, want no token`, body["token"])
+	}
+	body = hookBody(Hook{Url: "https://ci.example.com/hook"}, "secret")
+	if body["token"] != "secret" {
+		t.Errorf(`TestHookBody(token) = %v, want secret`, body["token"])
+	}
+}
+
+func TestGLCliExportHooks(t *testing.T) {
+	server, _ := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/hooks": `[{"id": 1, "url": "https://ci.example.com/hook", "push_events": true, "enable_ssl_verification": true}]`,
+	})
+	filename := filepath.Join(t.TempDir(), "hooks.json")
+	err := os.WriteFile(filename, []byte(`{"hooks": [{"url": "https://ci.example.com/hook", "events": [], "token_ref": "env:CI_HOOK_TOKEN"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	glcli.exportHooks(filename)
+	data, err := ImportHookFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Hook{Url: "https://ci.example.com/hook", Events: []string{"push"}, EnableSslVerification: true, TokenRef: "env:CI_HOOK_TOKEN"}
+	if len(data.Hooks) != 1 || !data.Hooks[0].Equal(want) || data.Hooks[0].TokenRef != want.TokenRef {
+		t.Errorf(`TestGLCliExportHooks(hooks) = %v, want %v`, data.Hooks, want)
+	}
+}
+
+func TestGLCliGroupHooks(t *testing.T) {
+	hooks := `[{"id": 1, "url": "https://ci.example.com/hook", "push_events": true, "enable_ssl_verification": true}]`
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/hooks": hooks,
+		"GET /api/v4/groups/7/hooks":    hooks,
+	})
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.GroupId = "7"
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	filename := filepath.Join(t.TempDir(), "hooks.json")
+
+	glcli.exportHooks(filename)
+	data, err := ImportHookFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Hooks) != 1 || data.GroupHooks != nil {
+		t.Errorf(`TestGLCliGroupHooks(new file) = %v, want project hooks only`, data)
+	}
+	glcli.syncHookFile(filename)
+	for _, request := range rec.requests {
+		if strings.Contains(request, "/groups/") {
+			t.Errorf(`TestGLCliGroupHooks(request) = %s, want no group request`, request)
+		}
+	}
+
+	err = os.WriteFile(filename, []byte(`{"hooks": [], "group_hooks": [{"url": "https://ci.example.com/hook", "token_ref": "env:CI_HOOK_TOKEN"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli.exportHooks(filename)
+	data, err = ImportHookFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.groupHooks()) != 1 || data.groupHooks()[0].TokenRef != "env:CI_HOOK_TOKEN" {
+		t.Errorf(`TestGLCliGroupHooks(group hooks) = %v, want the hook with its token reference`, data.groupHooks())
+	}
+}
+
+func TestGLCliSyncHookFile(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/hooks": `[{"id": 1, "url": "https://ci.example.com/build", "push_events": true, "enable_ssl_verification": true},
+			{"id": 2, "url": "https://chat.example.com/notify", "pipeline_events": true, "enable_ssl_verification": true},
+			{"id": 3, "url": "https://old.example.com/hook", "push_events": true, "enable_ssl_verification": true}]`,
+		"GET /api/v4/groups/7/hooks": `[]`,
+	})
+	t.Setenv("GLCLI_TEST_HOOK_TOKEN", "hook-secret")
+	filename := filepath.Join(t.TempDir(), "hooks.json")
+	err := os.WriteFile(filename, []byte(`{
+		"hooks": [
+			{"url": "https://ci.example.com/build", "events": ["push", "pipeline"], "token_ref": "env:GLCLI_TEST_HOOK_TOKEN"},
+			{"url": "https://chat.example.com/notify", "events": ["pipeline"]},
+			{"url": "https://deploy.example.com/hook", "events": ["deployment"], "enable_ssl_verification": false}
+		],
+		"group_hooks": [{"url": "https://audit.example.com/hook", "events": ["push"]}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.GroupId = "7"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.syncHookFile(filename)
+	rec.expectWrites(t, "TestGLCliSyncHookFile(dry run requests)", nil)
+
+	glcli.Config.DryrunMode = false
+	glcli.syncHookFile(filename)
+	bodies := rec.bodies
+	rec.expectWrites(t, "TestGLCliSyncHookFile(requests)", []string{
+		"DELETE /api/v4/projects/51/hooks/3",
+		"POST /api/v4/groups/7/hooks",
+		"POST /api/v4/projects/51/hooks",
+		"PUT /api/v4/projects/51/hooks/1",
+	})
+	update := bodies["PUT /api/v4/projects/51/hooks/1"]
+	if update["token"] != "hook-secret" || update["pipeline_events"] != true || update["push_events"] != true || update["job_events"] != false {
+		t.Errorf(`TestGLCliSyncHookFile(hook update) = %v, want push and pipeline events with the resolved token`, update)
+	}
+	created := bodies["POST /api/v4/projects/51/hooks"]
+	if created["url"] != "https://deploy.example.com/hook" || created["enable_ssl_verification"] != false || created["token"] != nil {
+		t.Errorf(`TestGLCliSyncHookFile(hook creation) = %v, want the deploy hook without SSL verification nor token`, created)
+	}
+
+	glcli.Config.DeleteMode = false
+	glcli.syncHookFile(filename)
+	for _, request := range rec.writes() {
+		if strings.HasPrefix(request, http.MethodDelete) {
+			t.Errorf(`TestGLCliSyncHookFile(request without delete mode) = %s, want no delete`, request)
+		}
+	}
+}
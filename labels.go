@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Label colors are given in hexadecimal notation, as Gitlab returns them.
+var labelColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Label is a label of label file, matched by name. Priority only applies to
+// project labels.
+type Label struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+	Priority    *int   `json:"priority,omitempty"`
+}
+
+// GitlabLabel is a label as returned by Gitlab API.
+type GitlabLabel struct {
+	Id int `json:"id"`
+	Label
+}
+
+// Equal tells if both labels have the same color, case insensitive, and
+// description, and the same priority when withPriority is set.
+func (label Label) Equal(other Label, withPriority bool) bool {
+	if !strings.EqualFold(label.Color, other.Color) || label.Description != other.Description {
+		return false
+	}
+	if !withPriority {
+		return true
+	}
+	if label.Priority == nil || other.Priority == nil {
+		return label.Priority == other.Priority
+	}
+	return *label.Priority == *other.Priority
+}
+
+// ImportLabelFile reads a label file and checks names, colors and
+// priorities.
+func ImportLabelFile(filename string) ([]Label, error) {
+	var data []Label
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	seen := make(map[string]bool)
+	for idx, item := range data {
+		if item.Name == "" {
+			return nil, fmt.Errorf("label %d of %s has no name", idx+1, filename)
+		}
+		if seen[item.Name] {
+			return nil, fmt.Errorf("label %s is defined twice in %s", item.Name, filename)
+		}
+		seen[item.Name] = true
+		if !labelColor.MatchString(item.Color) {
+			return nil, fmt.Errorf("color %s of label %s in %s is not allowed (must be like #FF0000)", item.Color, item.Name, filename)
+		}
+		if item.Priority != nil && *item.Priority < 0 {
+			return nil, fmt.Errorf("priority of label %s in %s cannot be negative", item.Name, filename)
+		}
+	}
+	return data, nil
+}
+
+// ExportLabelFile writes labels to filename, sorted by name.
+func ExportLabelFile(filename string, data []Label) error {
+	sorted := make([]Label, len(data))
+	copy(sorted, data)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// CompareLabels returns the labels of label file missing on Gitlab, the
+// Gitlab labels missing in the file, and the Gitlab labels to update with the
+// attributes of the file.
+func CompareLabels(data []Label, gitlab []GitlabLabel, withPriority bool) ([]Label, []GitlabLabel, []GitlabLabel) {
+	var toAdd []Label
+	var toDelete, toUpdate []GitlabLabel
+	current := make(map[string]GitlabLabel)
+	for _, item := range gitlab {
+		current[item.Name] = item
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Name] = true
+		label, found := current[item.Name]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if !item.Equal(label.Label, withPriority) {
+			toUpdate = append(toUpdate, GitlabLabel{Id: label.Id, Label: item})
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Name] {
+			toDelete = append(toDelete, item)
+		}
+	}
+	return toAdd, toDelete, toUpdate
+}
+
+func labelsPath(kind string, id string) string {
+	return kind + "/" + url.PathEscape(id) + "/labels"
+}
+
+// labelBody returns the attributes of a label for Gitlab API. A nil priority
+// removes the priority of a project label.
+func labelBody(item Label, withPriority bool) map[string]any {
+	body := map[string]any{
+		"name":        item.Name,
+		"color":       item.Color,
+		"description": item.Description,
+	}
+	if withPriority {
+		body["priority"] = item.Priority
+	}
+	return body
+}
+
+// getLabels returns the labels of a project or a group, without the labels
+// inherited from ancestor groups.
+func (glcli *GLCli) getLabels(path string) []GitlabLabel {
+	var data []GitlabLabel
+	err := glcli.client.GetAll(path+"?include_ancestor_groups=false", &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch labels from gitlab: %s", err)
+	}
+	return data
+}
+
+// insertLabel creates a label of a project or a group.
+func (glcli *GLCli) insertLabel(path string, item Label, withPriority bool) error {
+	err := glcli.client.Request(http.MethodPost, path, labelBody(item, withPriority), nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Insert label %s", item.Name)
+	return nil
+}
+
+// updateLabel sets the color, description and priority of a label.
+func (glcli *GLCli) updateLabel(path string, item GitlabLabel, withPriority bool) error {
+	err := glcli.client.Request(http.MethodPut, fmt.Sprintf("%s/%d", path, item.Id), labelBody(item.Label, withPriority), nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Update label %s", item.Name)
+	return nil
+}
+
+// deleteLabel deletes a label of a project or a group.
+func (glcli *GLCli) deleteLabel(path string, item GitlabLabel) error {
+	err := glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", path, item.Id), nil, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Delete label %s", item.Name)
+	return nil
+}
+
+// exportLabels writes the labels of a project or a group in filename. The
+// file is only written when there is a label or when it exists.
+func (glcli *GLCli) exportLabels(kind string, id string, filename string) {
+	var data []Label
+	for _, item := range glcli.getLabels(labelsPath(kind, id)) {
+		if kind != "projects" {
+			item.Priority = nil
+		}
+		data = append(data, item.Label)
+	}
+	if len(data) == 0 {
+		_, err := os.Stat(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			if glcli.Config.VerboseMode {
+				log.Printf("No label to export in %s file", filename)
+			}
+			return
+		}
+	}
+	err := ExportLabelFile(filename, data)
+	if err != nil {
+		log.Fatalf("Cannot export labels to %s: %s", filename, err)
+	}
+}
+
+// syncLabels applies the label file on a project or a group. Labels missing
+// in the file are only deleted in delete mode.
+func (glcli *GLCli) syncLabels(kind string, id string, filename string) {
+	data, err := ImportLabelFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import label file: %s", err)
+	}
+	path := labelsPath(kind, id)
+	withPriority := kind == "projects"
+	labelToAdd, labelToDelete, labelToUpdate := CompareLabels(data, glcli.getLabels(path), withPriority)
+	glcli.summary.Labels.count(len(labelToAdd), len(labelToUpdate), len(labelToDelete), glcli.Config.DeleteMode)
+	for _, item := range labelToAdd {
+		log.Printf("Label %s should be inserted", item.Name)
+		if !glcli.Config.DryrunMode {
+			err = glcli.insertLabel(path, item, withPriority)
+			if err != nil {
+				log.Fatalf("Cannot insert label %s: %s", item.Name, err)
+			}
+		}
+	}
+	if len(labelToAdd) == 0 {
+		log.Print("No label to insert")
+	}
+	for _, item := range labelToUpdate {
+		log.Printf("Label %s should be updated", item.Name)
+		if !glcli.Config.DryrunMode {
+			err = glcli.updateLabel(path, item, withPriority)
+			if err != nil {
+				log.Fatalf("Cannot update label %s: %s", item.Name, err)
+			}
+		}
+	}
+	if len(labelToUpdate) == 0 {
+		log.Print("No label to update")
+	}
+	if len(labelToDelete) == 0 {
+		log.Print("No label to delete")
+	}
+	if glcli.Config.DeleteMode {
+		for _, item := range labelToDelete {
+			log.Printf("Label %s should be deleted", item.Name)
+			if !glcli.Config.DryrunMode {
+				err = glcli.deleteLabel(path, item)
+				if err != nil {
+					log.Fatalf("Cannot delete label %s: %s", item.Name, err)
+				}
+			}
+		}
+	} else if len(labelToDelete) > 0 {
+		log.Printf("%d label(s) may be deleted, but delete flag in command line is not set", len(labelToDelete))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportLabelFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		`[{"name": "bug", "color": "#d9534f", "description": "Something is broken", "priority": 1}, {"name": "feature", "color": "#5CB85C"}]`: true,
+		`[{"color": "#d9534f"}]`:                                               false,
+		`[{"name": "bug", "color": "red"}]`:                                    false,
+		`[{"name": "bug", "color": "#d9534f", "priority": -1}]`:                false,
+		`[{"name": "bug", "color": "#d95"}, {"name": "bug", "color": "#d95"}]`: false,
+	}
+	for content, valid := range tests {
+		filename := filepath.Join(dir, "labels.json")
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ImportLabelFile(filename)
+		if (err == nil) != valid {
+			t.Errorf(`TestImportLabelFile(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+}
+
+func TestCompareLabels(t *testing.T) {
+	var gitlab []GitlabLabel
+	err := json.Unmarshal([]byte(`[
+		{"id": 1, "name": "bug", "color": "#D9534F", "description": "Something is broken", "priority": 1},
+		{"id": 2, "name": "feature", "color": "#5cb85c", "description": "", "priority": null},
+		{"id": 3, "name": "wontfix", "color": "#ffffff", "description": "", "priority": null}
+	]`), &gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priority := 2
+	data := []Label{
+		{Name: "bug", Color: "#d9534f", Description: "Something is broken"},
+		{Name: "feature", Color: "#5cb85c", Priority: &priority},
+		{Name: "security", Color: "#ff0000"},
+	}
+	toAdd, toDelete, toUpdate := CompareLabels(data, gitlab, true)
+	if len(toAdd) != 1 || toAdd[0].Name != "security" {
+		t.Errorf(`TestCompareLabels(labels to add) = %v, want only security`, toAdd)
+	}
+	if len(toDelete) != 1 || toDelete[0].Id != 3 {
+		t.Errorf(`TestCompareLabels(labels to delete) = %v, want only wontfix`, toDelete)
+	}
+	if len(toUpdate) != 2 || toUpdate[0].Id != 1 || toUpdate[1].Id != 2 {
+		t.Errorf(`TestCompareLabels(labels to update) = %v, want bug and feature`, toUpdate)
+	}
+
+	_, _, toUpdate = CompareLabels(data, gitlab, false)
+	if len(toUpdate) != 0 {
+		t.Errorf(`TestCompareLabels(group labels to update) = %v, want none`, toUpdate)
+	}
+}
+
+func TestLabelBody(t *testing.T) {
+	content, err := json.Marshal(labelBody(Label{Name: "bug", Color: "#d9534f"}, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"color":"#d9534f","description":"","name":"bug","priority":null}`
+	if string(content) != want {
+		t.Errorf(`TestLabelBody(project label) = %s, want %s`, content, want)
+	}
+	if _, found := labelBody(Label{Name: "bug", Color: "#d9534f"}, false)["priority"]; found {
+		t.Errorf(`TestLabelBody(group label) has priority, want none`)
+	}
+}
+
+func TestGLCliSyncLabels(t *testing.T) {
+	labels := `[{"id": 1, "name": "bug", "color": "#FF0000", "description": "", "priority": 1},
+		{"id": 2, "name": "doc", "color": "#0000ff", "description": "Documentation"},
+		{"id": 3, "name": "legacy", "color": "#cccccc", "description": ""}]`
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/labels": labels,
+		"GET /api/v4/groups/7/labels":    labels,
+	})
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "labels.json")
+	err := os.WriteFile(filename, []byte(`[{"name": "bug", "color": "#ff0000", "description": "", "priority": 1},
+		{"name": "doc", "color": "#0000ff", "description": "Docs"},
+		{"name": "feature", "color": "#00ff00", "description": ""}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	defer log.SetOutput(os.Stderr)
+
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.syncLabels("projects", "51", filename)
+	rec.expectWrites(t, "TestGLCliSyncLabels(dry run requests)", nil)
+	if !strings.Contains(buffer.String(), "Label legacy should be deleted") || strings.Contains(buffer.String(), "delete flag") {
+		t.Errorf(`TestGLCliSyncLabels(dry run log) = %s, want legacy to be deleted`, buffer.String())
+	}
+
+	glcli.Config.DryrunMode = false
+	glcli.syncLabels("projects", "51", filename)
+	update := rec.bodies["PUT /api/v4/projects/51/labels/2"]
+	rec.expectWrites(t, "TestGLCliSyncLabels(requests)", []string{
+		"DELETE /api/v4/projects/51/labels/3",
+		"POST /api/v4/projects/51/labels",
+		"PUT /api/v4/projects/51/labels/2",
+	})
+	if update["description"] != "Docs" || update["priority"] != nil {
+		t.Errorf(`TestGLCliSyncLabels(label update) = %v, want the new description without priority`, update)
+	}
+
+	buffer.Reset()
+	glcli.Config.DeleteMode = false
+	glcli.syncLabels("groups", "7", filename)
+	for _, request := range rec.writes() {
+		if strings.HasPrefix(request, http.MethodDelete) {
+			t.Errorf(`TestGLCliSyncLabels(request without delete mode) = %s, want no delete`, request)
+		}
+		if _, found := rec.bodies[request]["priority"]; found {
+			t.Errorf(`TestGLCliSyncLabels(group label %s) = %v, want no priority`, request, rec.bodies[request])
+		}
+	}
+	if !strings.Contains(buffer.String(), "1 label(s) may be deleted, but delete flag in command line is not set") {
+		t.Errorf(`TestGLCliSyncLabels(log without delete mode) = %s, want the delete flag message`, buffer.String())
+	}
+}
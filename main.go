@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 func main() {
@@ -12,20 +13,39 @@ func main() {
 	glcli := NewGLCli()
 
 	var projectId = flag.String("id", "", "Gitlab project identifiant.")
-	var groupId = flag.String("gid", "", "Gitlab group identifiant.")
+	var groupId = flag.String("gid", "", "Gitlab group identifiant or path.")
+	var groupOnly = flag.Bool("group-only", glcli.Config.GroupOnlyMode, "Manage group vars only, without project.")
+	var recursive = flag.Bool("recursive", glcli.Config.RecursiveMode, "Apply group var file to all subgroups of group (with group-only option).")
+	var includeGroups = flag.String("include", "", "Apply group var file only to subgroups whose path matches this glob, or regular expression with re: prefix.")
+	var excludeGroups = flag.String("exclude", "", "Do not apply group var file to subgroups whose path matches this glob, or regular expression with re: prefix.")
 	var projectIdFile = flag.String("idfile", glcli.Config.IdFile, "Gitlab project identifiant file.")
 	var groupIdFile = flag.String("gidfile", glcli.Config.GroupIdFile, "Gitlab group identifiant file.")
 	var varsFile = flag.String("varfile", glcli.Config.VarsFile, "File which contains vars.")
 	var envsFile = flag.String("envfile", glcli.Config.EnvsFile, "File which contains envs.")
 	var groupvarsFile = flag.String("groupvarfile", glcli.Config.GroupVarsFile, "File which contains group vars.")
+	var schedulesFile = flag.String("schedulefile", glcli.Config.SchedulesFile, "File which contains pipeline schedules.")
+	var triggersFile = flag.String("triggerfile", glcli.Config.TriggersFile, "File which contains pipeline triggers.")
+	var secretsFile = flag.String("secretfile", glcli.Config.SecretsFile, "File where tokens of created pipeline triggers are written.")
+	var deployFile = flag.String("deployfile", glcli.Config.DeployFile, "File which contains deploy tokens and deploy keys.")
+	var labelsFile = flag.String("labelfile", glcli.Config.LabelsFile, "File which contains labels of project, or of group with group-only option.")
+	var hooksFile = flag.String("hookfile", glcli.Config.HooksFile, "File which contains project and group webhooks.")
+	var ciSettingsFile = flag.String("cisettingsfile", glcli.Config.CISettingsFile, "File which contains CI settings of project.")
+	var protectedFile = flag.String("protectedfile", glcli.Config.ProtectedFile, "File which contains protected branches and tags.")
 	var projectsFile = flag.String("projectfile", glcli.Config.ProjectsFile, "File which contains projects.")
 	var gitlabUrl = flag.String("url", glcli.Config.GitlabUrl, "Gitlab URL.")
 	var gitlabTokenFile = flag.String("tokenfile", glcli.Config.TokenFile, "File which contains token to access Gitlab API.")
+	var tokenHelper = flag.String("token-helper", glcli.Config.TokenHelper, "Git credential helper command which gives token to access Gitlab API.")
+	var tokenExpiryWarning = flag.Int("token-expiry-warning", glcli.Config.TokenExpiryWarning, "Warn when Gitlab token expires within this number of days.")
+	var keyFile = flag.String("keyfile", glcli.Config.KeyFile, "File which contains age keys to encrypt and decrypt var values.")
+	var vaultAddr = flag.String("vault-addr", glcli.Config.VaultAddr, "Vault address used to resolve vault value references.")
+	var vaultNamespace = flag.String("vault-namespace", glcli.Config.VaultNamespace, "Vault namespace.")
+	var vaultTokenFile = flag.String("vault-tokenfile", glcli.Config.VaultTokenFile, "File which contains token to access Vault API when VAULT_TOKEN is not set.")
 	var remoteName = flag.String("remote", glcli.Config.RemoteName, "Git remote name.")
 	var verbose = flag.Bool("verbose", glcli.Config.VerboseMode, "Make application more talkative.")
 	var debug = flag.Bool("debug", glcli.Config.DebugMode, "Enable debug mode")
 	var dryrun = flag.Bool("dryrun", glcli.Config.DryrunMode, "Run in dry-run mode (read only).")
 	var export = flag.Bool("export", glcli.Config.ExportMode, "Export current variables in var file.")
+	var sops = flag.Bool("sops", glcli.Config.SopsMode, "Write SOPS-encrypted var files on export.")
 	var exportProjectsOnly = flag.Bool("export-projects", false, "Export current projects in project file.")
 	var deleteIsActive = flag.Bool("delete", glcli.Config.DeleteMode, "Delete Gitlab var if not present in var file.")
 	var allProjects = flag.Bool("all-projects", false, "Export all projects, not only projects where I'm a membership.")
@@ -36,10 +56,22 @@ func main() {
 	var duplicateVarsInEnvFrom = flag.String("duplicate-from", "", "Duplicate all vars from specified env (Must be set with duplicate-to option).")
 	var duplicateVarsInEnvTo = flag.String("duplicate-to", "", "Duplicate all vars from env to specified env (Must be set with duplicate-from option).")
 	var adminIsActive = flag.Bool("admin", false, "Admin mode")
+	var setHookTokens = flag.Bool("set-hook-tokens", glcli.Config.SetHookTokens, "Set secret token of all webhooks which have a token reference.")
+	var allowExecRefs = flag.Bool("allow-exec-refs", glcli.Config.AllowExecRefs, "Run the command of exec value references.")
+	var allowInsecureFiles = flag.Bool("allow-insecure-token-file", glcli.Config.AllowInsecureFiles, "Use token and key files even if group or others can access them.")
 
 	flag.Usage = func() {
 		fmt.Print("Export variables from json file to project gitlab variables or vice versa\n\n")
-		fmt.Printf("Usage: " + os.Args[0] + " [options]\n")
+		fmt.Printf("Usage: " + os.Args[0] + " [options] [command]\n")
+		fmt.Print("Commands:\n")
+		fmt.Print("  fmt [files]\n        Rewrite var, env and project files in canonical form.\n")
+		fmt.Print("  encrypt [files]\n        Encrypt values of masked, hidden and protected vars in var files.\n")
+		fmt.Print("  convert -from <file> -to <file> [-model vars|envs]\n        Convert a var or env file between JSON, YAML, CSV and dotenv formats.\n")
+		fmt.Print("  fleet apply|plan|pull [-manifest <file>] [-select <pattern>] [-visibility <visibility>] [-select-gid <id>] [-labels]\n        Import, plan or export all projects of a fleet manifest or selected projects.\n")
+		fmt.Print("  envs stop|delete <name> [-yes]\n        Stop, or stop and delete, an environment of the project.\n")
+		fmt.Print("  envs prune -match <pattern> -older-than <duration> [-yes]\n        Stop and delete environments whose name matches and which are inactive for this duration (like 720h or 30d).\n")
+		fmt.Print("  triggers list\n        List pipeline triggers of the project.\n")
+		fmt.Print("Options:\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -47,6 +79,16 @@ func main() {
 	var envFrom string
 	var envTo string
 
+	if *allowInsecureFiles {
+		log.Print("Insecure token and key files are allowed")
+		glcli.Config.AllowInsecureFiles = true
+	}
+	if *allowExecRefs {
+		glcli.Config.AllowExecRefs = true
+	}
+	if *setHookTokens {
+		glcli.Config.SetHookTokens = true
+	}
 	if *verbose {
 		log.Print("Verbose mode is active")
 		glcli.Config.VerboseMode = true
@@ -63,8 +105,13 @@ func main() {
 		log.Print("Export requested")
 		glcli.Config.ExportMode = true
 	}
+	if *sops {
+		log.Print("SOPS mode is active")
+		glcli.Config.SopsMode = true
+	}
 	if *exportProjectsOnly {
 		log.Print("Export projects requested")
+		glcli.Config.ReadOnlyMode = true
 	}
 	if *deleteIsActive {
 		log.Print("Delete mode is active")
@@ -103,18 +150,65 @@ func main() {
 	if envsFile != nil {
 		glcli.Config.EnvsFile = *envsFile
 	}
+	if schedulesFile != nil {
+		glcli.Config.SchedulesFile = *schedulesFile
+	}
+	if triggersFile != nil {
+		glcli.Config.TriggersFile = *triggersFile
+	}
+	if secretsFile != nil {
+		glcli.Config.SecretsFile = *secretsFile
+	}
+	if deployFile != nil {
+		glcli.Config.DeployFile = *deployFile
+	}
+	if labelsFile != nil {
+		glcli.Config.LabelsFile = *labelsFile
+	}
+	if hooksFile != nil {
+		glcli.Config.HooksFile = *hooksFile
+	}
+	if ciSettingsFile != nil {
+		glcli.Config.CISettingsFile = *ciSettingsFile
+	}
+	if protectedFile != nil {
+		glcli.Config.ProtectedFile = *protectedFile
+	}
 	if projectsFile != nil {
 		glcli.Config.ProjectsFile = *projectsFile
 	}
 	if groupvarsFile != nil {
 		glcli.Config.GroupVarsFile = *groupvarsFile
 	}
+	// Resource files given on command line are exported even if they do not exist
+	flag.Visit(func(option *flag.Flag) {
+		switch option.Name {
+		case "schedulefile", "triggerfile", "deployfile", "protectedfile", "cisettingsfile", "hookfile", "labelfile":
+			glcli.Config.RequestedFiles = append(glcli.Config.RequestedFiles, option.Value.String())
+		}
+	})
 	if gitlabUrl != nil {
 		glcli.Config.GitlabUrl = *gitlabUrl
 	}
 	if gitlabTokenFile != nil {
 		glcli.Config.TokenFile = *gitlabTokenFile
 	}
+	if tokenHelper != nil {
+		glcli.Config.TokenHelper = *tokenHelper
+	}
+	glcli.Config.TokenExpiryWarning = *tokenExpiryWarning
+	if keyFile != nil {
+		glcli.Config.KeyFile = *keyFile
+	}
+	if vaultAddr != nil {
+		glcli.Config.VaultAddr = *vaultAddr
+	}
+	if vaultNamespace != nil {
+		glcli.Config.VaultNamespace = *vaultNamespace
+	}
+	if vaultTokenFile != nil {
+		glcli.Config.VaultTokenFile = *vaultTokenFile
+	}
 	if projectId != nil {
 		glcli.ProjectId = *projectId
 	}
@@ -124,20 +218,118 @@ func main() {
 	if remoteName != nil {
 		glcli.RemoteName = *remoteName
 	}
+	if *groupOnly {
+		log.Print("Group-only mode is active")
+		glcli.Config.GroupOnlyMode = true
+	}
+	if *recursive {
+		if !*groupOnly {
+			log.Fatal("Recursive mode requires the group-only option")
+		}
+		log.Print("Recursive mode is active")
+		glcli.Config.RecursiveMode = true
+	}
+	glcli.Config.IncludeGroups = *includeGroups
+	glcli.Config.ExcludeGroups = *excludeGroups
 	if *adminIsActive {
 		log.Print("Admin mode is active")
+		glcli.Config.AdminMode = true
 	}
 	if envFrom != "" && envTo != "" {
 		log.Printf("Copy all variables from %s environment to %s one\n", envFrom, envTo)
 		glcli.CopyVars(envFrom, envTo)
 		return
 	}
+	switch flag.Arg(0) {
+	case "":
+	case "fmt":
+		log.Print("Format mode is active")
+		glcli.Format(flag.Args()[1:])
+		return
+	case "encrypt":
+		log.Print("Encrypt mode is active")
+		glcli.Encrypt(flag.Args()[1:])
+		return
+	case "convert":
+		convertFlags := flag.NewFlagSet("convert", flag.ExitOnError)
+		var from = convertFlags.String("from", "", "Source file.")
+		var to = convertFlags.String("to", "", "Target file.")
+		var model = convertFlags.String("model", "", "File content: vars or envs (detected from source file if empty).")
+		err := convertFlags.Parse(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *from == "" || *to == "" {
+			log.Fatal("Convert command requires from and to options")
+		}
+		glcli.Convert(*from, *to, *model)
+		return
+	case "fleet":
+		if flag.NArg() < 2 {
+			log.Fatal("Fleet command requires an action: apply, plan or pull")
+		}
+		fleetFlags := flag.NewFlagSet("fleet", flag.ExitOnError)
+		var manifest = fleetFlags.String("manifest", glcli.Config.FleetFile, "Fleet manifest file.")
+		var selection ProjectSelection
+		fleetFlags.StringVar(&selection.Pattern, "select", "", "Select projects of project file whose path matches this glob, or regular expression with re: prefix, instead of manifest.")
+		fleetFlags.StringVar(&selection.Visibility, "visibility", "", "Select projects of project file with this visibility.")
+		fleetFlags.StringVar(&selection.GroupId, "select-gid", "", "Select projects of project file in this group id.")
+		var labels = fleetFlags.Bool("labels", false, "Apply or plan only the label file on each project.")
+		err := fleetFlags.Parse(flag.Args()[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		glcli.Config.FleetFile = *manifest
+		log.Printf("Fleet %s mode is active", flag.Arg(1))
+		glcli.Fleet(flag.Arg(1), glcli.Config.FleetFile, selection, *labels)
+		return
+	case "envs":
+		if flag.NArg() < 2 {
+			log.Fatal("Envs command requires an action: stop, delete or prune")
+		}
+		envsFlags := flag.NewFlagSet("envs", flag.ExitOnError)
+		var options EnvsOptions
+		envsFlags.StringVar(&options.Pattern, "match", "", "Prune envs whose name matches this glob, or regular expression with re: prefix.")
+		envsFlags.StringVar(&options.Age, "older-than", "", "Prune envs inactive for this duration.")
+		envsFlags.BoolVar(&options.AssumeYes, "yes", false, "Do not ask for confirmation.")
+		action := flag.Arg(1)
+		args := flag.Args()[2:]
+		var name string
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			name = args[0]
+			args = args[1:]
+		}
+		err := envsFlags.Parse(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Envs %s mode is active", action)
+		glcli.SetProjectParameters(*allProjects, *simpleRequest)
+		glcli.Setup()
+		glcli.resolveProject()
+		glcli.Envs(action, name, options)
+		return
+	case "triggers":
+		if flag.Arg(1) != "list" {
+			log.Fatal("Triggers command requires the list action")
+		}
+		glcli.Config.ReadOnlyMode = true
+		glcli.SetProjectParameters(*allProjects, *simpleRequest)
+		glcli.Setup()
+		glcli.resolveProject()
+		glcli.ListTriggers()
+		return
+	default:
+		log.Fatalf("Unknown command %s", flag.Arg(0))
+	}
 	glcli.SetProjectParameters(*allProjects, *simpleRequest)
 	glcli.Setup()
 	if *exportProjectsOnly {
 		glcli.ExportProjects()
 	} else if *adminIsActive {
 		glcli.AdminRun()
+	} else if glcli.Config.GroupOnlyMode {
+		glcli.GroupRun()
 	} else {
 		glcli.Run()
 	}
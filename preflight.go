@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// TokenInfo is the metadata of the personal, project or group access token
+// in use.
+type TokenInfo struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Active    bool     `json:"active"`
+	Revoked   bool     `json:"revoked"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+// UserInfo is the user who owns the token in use.
+type UserInfo struct {
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// CheckToken checks that the token allows the requested mode: write mode
+// requires the api scope, read mode the api or read_api scope, and admin mode
+// an administrator. Scopes are not checked when token is nil. It returns a
+// warning when the token expires within warnDays days.
+func CheckToken(token *TokenInfo, user UserInfo, write bool, admin bool, now time.Time, warnDays int) (string, error) {
+	if admin && !user.IsAdmin {
+		return "", fmt.Errorf("admin mode requires an administrator, but %s is not", user.Username)
+	}
+	if token == nil {
+		return "", nil
+	}
+	if token.Revoked || !token.Active {
+		return "", fmt.Errorf("token %s is revoked or expired", token.Name)
+	}
+	if write && !slices.Contains(token.Scopes, "api") {
+		return "", fmt.Errorf("token %s has scopes %v, but the api scope is required to change Gitlab (use -dryrun or -export to only read)", token.Name, token.Scopes)
+	}
+	if !slices.Contains(token.Scopes, "api") && !slices.Contains(token.Scopes, "read_api") {
+		return "", fmt.Errorf("token %s has scopes %v, but the api or read_api scope is required", token.Name, token.Scopes)
+	}
+	if token.ExpiresAt == "" {
+		return "", nil
+	}
+	expiry, err := time.Parse(time.DateOnly, token.ExpiresAt)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse expiry date of token %s: %w", token.Name, err)
+	}
+	days := int(expiry.Sub(now).Hours() / 24)
+	if !now.Before(expiry) {
+		return "", fmt.Errorf("token %s expired on %s", token.Name, token.ExpiresAt)
+	}
+	if days < warnDays {
+		return fmt.Sprintf("Token %s expires on %s, in %d day(s)", token.Name, token.ExpiresAt, days), nil
+	}
+	return "", nil
+}
+
+// Preflight checks the token before anything is requested, so a token without
+// the required scope or rights fails with a clear message.
+func (glcli *GLCli) Preflight() {
+	var gitlabErr *GitlabError
+	var token TokenInfo
+	tokenFound := true
+	err := glcli.client.Request(http.MethodGet, "personal_access_tokens/self", nil, &token)
+	if errors.As(err, &gitlabErr) && gitlabErr.StatusCode == http.StatusUnauthorized {
+		log.Fatal("Gitlab token is invalid, expired or revoked")
+	}
+	if err != nil {
+		log.Printf("Cannot check token scopes: %s", err)
+		tokenFound = false
+	}
+	var user UserInfo
+	err = glcli.client.Request(http.MethodGet, "user", nil, &user)
+	if errors.As(err, &gitlabErr) && gitlabErr.StatusCode == http.StatusUnauthorized {
+		log.Fatal("Gitlab token is invalid, expired or revoked")
+	}
+	if err != nil {
+		log.Printf("Cannot check token: %s", err)
+		return
+	}
+	if glcli.Config.VerboseMode {
+		if tokenFound {
+			log.Printf("Token %s of user %s has scopes %v", token.Name, user.Username, token.Scopes)
+		} else {
+			log.Printf("Token of user %s", user.Username)
+		}
+	}
+	write := !glcli.Config.ReadOnlyMode && !glcli.Config.ExportMode && !glcli.Config.DryrunMode
+	var info *TokenInfo
+	if tokenFound {
+		info = &token
+	}
+	warning, err := CheckToken(info, user, write, glcli.Config.AdminMode, time.Now(), glcli.Config.TokenExpiryWarning)
+	if err != nil {
+		log.Fatalf("Gitlab token cannot be used: %s", err)
+	}
+	if warning != "" {
+		log.Print(warning)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckToken(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	user := UserInfo{Username: "dev", IsAdmin: false}
+	readToken := TokenInfo{Name: "ci", Scopes: []string{"read_api"}, Active: true, ExpiresAt: "2026-12-31"}
+	apiToken := TokenInfo{Name: "deploy", Scopes: []string{"api"}, Active: true, ExpiresAt: "2026-03-11"}
+
+	_, err := CheckToken(&readToken, user, false, false, now, 30)
+	if err != nil {
+		t.Errorf(`TestCheckToken(read with read_api) = %s, want nil`, err)
+	}
+	_, err = CheckToken(&readToken, user, true, false, now, 30)
+	if err == nil {
+		t.Errorf(`TestCheckToken(write with read_api) = nil, want an error`)
+	}
+	_, err = CheckToken(&apiToken, user, true, true, now, 30)
+	if err == nil {
+		t.Errorf(`TestCheckToken(admin without administrator) = nil, want an error`)
+	}
+	warning, err := CheckToken(&apiToken, user, true, false, now, 30)
+	if err != nil || warning == "" {
+		t.Errorf(`TestCheckToken(token expiring in 9 days) = %q, %v, want a warning`, warning, err)
+	}
+	warning, _ = CheckToken(&apiToken, user, true, false, now, 5)
+	if warning != "" {
+		t.Errorf(`TestCheckToken(token expiring after warning delay) = %q, want no warning`, warning)
+	}
+	_, err = CheckToken(&apiToken, user, true, false, now.AddDate(0, 1, 0), 30)
+	if err == nil {
+		t.Errorf(`TestCheckToken(expired token) = nil, want an error`)
+	}
+}
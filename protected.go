@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+)
+
+// No one is allowed, to push on a protected branch for example.
+const accessLevelNoOne = 0
+
+// ProtectedBranch is a protected branch, or branch pattern, of protected
+// file. Access levels default to maintainers, as on Gitlab.
+type ProtectedBranch struct {
+	Name             string `json:"name"`
+	PushAccessLevel  int    `json:"push_access_level"`
+	MergeAccessLevel int    `json:"merge_access_level"`
+	AllowForcePush   bool   `json:"allow_force_push"`
+}
+
+func (branch *ProtectedBranch) UnmarshalJSON(data []byte) error {
+	type plain ProtectedBranch
+	item := plain{PushAccessLevel: accessLevelMaintainer, MergeAccessLevel: accessLevelMaintainer}
+	err := json.Unmarshal(data, &item)
+	*branch = ProtectedBranch(item)
+	return err
+}
+
+// ProtectedTag is a protected tag, or tag pattern, of protected file. The
+// access level defaults to maintainers, as on Gitlab.
+type ProtectedTag struct {
+	Name              string `json:"name"`
+	CreateAccessLevel int    `json:"create_access_level"`
+}
+
+func (tag *ProtectedTag) UnmarshalJSON(data []byte) error {
+	type plain ProtectedTag
+	item := plain{CreateAccessLevel: accessLevelMaintainer}
+	err := json.Unmarshal(data, &item)
+	*tag = ProtectedTag(item)
+	return err
+}
+
+// ProtectedData is the content of protected file.
+type ProtectedData struct {
+	Branches []ProtectedBranch `json:"branches"`
+	Tags     []ProtectedTag    `json:"tags"`
+}
+
+// GitlabProtectedBranch is a protected branch as returned by Gitlab API.
+type GitlabProtectedBranch struct {
+	Name              string       `json:"name"`
+	PushAccessLevels  []accessRule `json:"push_access_levels"`
+	MergeAccessLevels []accessRule `json:"merge_access_levels"`
+	AllowForcePush    bool         `json:"allow_force_push"`
+}
+
+// GitlabProtectedTag is a protected tag as returned by Gitlab API.
+type GitlabProtectedTag struct {
+	Name               string       `json:"name"`
+	CreateAccessLevels []accessRule `json:"create_access_levels"`
+}
+
+// roleRule returns the rule which gives an access level to a role. Rules of
+// users and groups are not managed by glcli.
+func roleRule(rules []accessRule) (accessRule, bool) {
+	for _, rule := range rules {
+		if rule.UserId == 0 && rule.GroupId == 0 {
+			return rule, true
+		}
+	}
+	return accessRule{}, false
+}
+
+// roleLevel returns the access level given to a role, or no one.
+func roleLevel(rules []accessRule) int {
+	rule, found := roleRule(rules)
+	if !found {
+		return accessLevelNoOne
+	}
+	return rule.AccessLevel
+}
+
+// Branch returns the protected branch in the protected file form.
+func (branch GitlabProtectedBranch) Branch() ProtectedBranch {
+	return ProtectedBranch{
+		Name:             branch.Name,
+		PushAccessLevel:  roleLevel(branch.PushAccessLevels),
+		MergeAccessLevel: roleLevel(branch.MergeAccessLevels),
+		AllowForcePush:   branch.AllowForcePush,
+	}
+}
+
+// Tag returns the protected tag in the protected file form.
+func (tag GitlabProtectedTag) Tag() ProtectedTag {
+	return ProtectedTag{Name: tag.Name, CreateAccessLevel: roleLevel(tag.CreateAccessLevels)}
+}
+
+func checkRoleLevel(level int) error {
+	if !slices.Contains([]int{accessLevelNoOne, accessLevelDeveloper, accessLevelMaintainer, accessLevelAdmin}, level) {
+		return fmt.Errorf("access level %d is not allowed (must be %d, %d, %d or %d)", level, accessLevelNoOne, accessLevelDeveloper, accessLevelMaintainer, accessLevelAdmin)
+	}
+	return nil
+}
+
+// ImportProtectedFile reads a protected file and checks names and access
+// levels.
+func ImportProtectedFile(filename string) (ProtectedData, error) {
+	var data ProtectedData
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return data, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	seen := make(map[string]bool)
+	for idx, item := range data.Branches {
+		if item.Name == "" {
+			return data, fmt.Errorf("protected branch %d of %s has no name", idx+1, filename)
+		}
+		if seen[item.Name] {
+			return data, fmt.Errorf("protected branch %s is defined twice in %s", item.Name, filename)
+		}
+		seen[item.Name] = true
+		err = errors.Join(checkRoleLevel(item.PushAccessLevel), checkRoleLevel(item.MergeAccessLevel))
+		if err != nil {
+			return data, fmt.Errorf("invalid protected branch %s in %s: %w", item.Name, filename, err)
+		}
+	}
+	seen = make(map[string]bool)
+	for idx, item := range data.Tags {
+		if item.Name == "" {
+			return data, fmt.Errorf("protected tag %d of %s has no name", idx+1, filename)
+		}
+		if seen[item.Name] {
+			return data, fmt.Errorf("protected tag %s is defined twice in %s", item.Name, filename)
+		}
+		seen[item.Name] = true
+		err = checkRoleLevel(item.CreateAccessLevel)
+		if err != nil {
+			return data, fmt.Errorf("invalid protected tag %s in %s: %w", item.Name, filename, err)
+		}
+	}
+	return data, nil
+}
+
+// ExportProtectedFile writes protected branches and tags to filename, sorted
+// by name.
+func ExportProtectedFile(filename string, data ProtectedData) error {
+	sorted := ProtectedData{
+		Branches: append([]ProtectedBranch{}, data.Branches...),
+		Tags:     append([]ProtectedTag{}, data.Tags...),
+	}
+	sort.SliceStable(sorted.Branches, func(i, j int) bool {
+		return sorted.Branches[i].Name < sorted.Branches[j].Name
+	})
+	sort.SliceStable(sorted.Tags, func(i, j int) bool {
+		return sorted.Tags[i].Name < sorted.Tags[j].Name
+	})
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// CompareProtectedBranches compares the protected branches of protected file
+// with the Gitlab ones.
+func CompareProtectedBranches(data []ProtectedBranch, gitlab []GitlabProtectedBranch) ([]ProtectedBranch, []ProtectedBranch, []string) {
+	var toAdd, toUpdate []ProtectedBranch
+	var toDelete []string
+	current := make(map[string]ProtectedBranch)
+	for _, item := range gitlab {
+		current[item.Name] = item.Branch()
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Name] = true
+		branch, found := current[item.Name]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if item != branch {
+			toUpdate = append(toUpdate, item)
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Name] {
+			toDelete = append(toDelete, item.Name)
+		}
+	}
+	return toAdd, toUpdate, toDelete
+}
+
+// CompareProtectedTags compares the protected tags of protected file with the
+// Gitlab ones.
+func CompareProtectedTags(data []ProtectedTag, gitlab []GitlabProtectedTag) ([]ProtectedTag, []ProtectedTag, []string) {
+	var toAdd, toUpdate []ProtectedTag
+	var toDelete []string
+	current := make(map[string]ProtectedTag)
+	for _, item := range gitlab {
+		current[item.Name] = item.Tag()
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Name] = true
+		tag, found := current[item.Name]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if item != tag {
+			toUpdate = append(toUpdate, item)
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Name] {
+			toDelete = append(toDelete, item.Name)
+		}
+	}
+	return toAdd, toUpdate, toDelete
+}
+
+func protectedBranchesPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/protected_branches"
+}
+
+func protectedTagsPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/protected_tags"
+}
+
+// getProtected returns the protected branches and tags of the project.
+func (glcli *GLCli) getProtected() ([]GitlabProtectedBranch, []GitlabProtectedTag) {
+	var branches []GitlabProtectedBranch
+	var tags []GitlabProtectedTag
+	err := glcli.client.GetAll(protectedBranchesPath(glcli.ProjectId), &branches)
+	if err == nil {
+		err = glcli.client.GetAll(protectedTagsPath(glcli.ProjectId), &tags)
+	}
+	if err != nil {
+		log.Fatalf("Cannot fetch protected branches and tags from gitlab: %s", err)
+	}
+	return branches, tags
+}
+
+// exportProtected writes the protected branches and tags of the project in
+// filename.
+func (glcli *GLCli) exportProtected(filename string) {
+	branches, tags := glcli.getProtected()
+	var data ProtectedData
+	for _, item := range branches {
+		data.Branches = append(data.Branches, item.Branch())
+	}
+	for _, item := range tags {
+		data.Tags = append(data.Tags, item.Tag())
+	}
+	err := ExportProtectedFile(filename, data)
+	if err != nil {
+		log.Fatalf("Cannot export protected branches and tags to %s: %s", filename, err)
+	}
+}
+
+// roleRuleUpdate returns the rules which replace the role rule of current by
+// the level. Rules of users and groups are kept. Maps are used because the
+// no one access level is 0, which accessRule omits.
+func roleRuleUpdate(current []accessRule, level int) []map[string]any {
+	rules := []map[string]any{}
+	rule, found := roleRule(current)
+	if found && rule.AccessLevel == level {
+		return rules
+	}
+	if found {
+		rules = append(rules, map[string]any{"id": rule.Id, "_destroy": true})
+	}
+	return append(rules, map[string]any{"access_level": level})
+}
+
+// syncProtectedBranches applies protected branches on the project. Branches
+// missing in the file are only unprotected in delete mode.
+func (glcli *GLCli) syncProtectedBranches(data []ProtectedBranch, gitlab []GitlabProtectedBranch) {
+	path := protectedBranchesPath(glcli.ProjectId)
+	toAdd, toUpdate, toDelete := CompareProtectedBranches(data, gitlab)
+	glcli.summary.ProtectedBranches.count(len(toAdd), len(toUpdate), len(toDelete), glcli.Config.DeleteMode)
+	current := make(map[string]GitlabProtectedBranch)
+	for _, item := range gitlab {
+		current[item.Name] = item
+	}
+	for _, item := range toAdd {
+		log.Printf("Branch %s should be protected", item.Name)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		body := map[string]any{
+			"name":               item.Name,
+			"push_access_level":  item.PushAccessLevel,
+			"merge_access_level": item.MergeAccessLevel,
+			"allow_force_push":   item.AllowForcePush,
+		}
+		err := glcli.client.Request(http.MethodPost, path, body, nil)
+		if err != nil {
+			log.Fatalf("Cannot protect branch %s: %s", item.Name, err)
+		}
+	}
+	for _, item := range toUpdate {
+		log.Printf("Protection of branch %s should be updated", item.Name)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		body := map[string]any{
+			"allow_force_push": item.AllowForcePush,
+			"allowed_to_push":  roleRuleUpdate(current[item.Name].PushAccessLevels, item.PushAccessLevel),
+			"allowed_to_merge": roleRuleUpdate(current[item.Name].MergeAccessLevels, item.MergeAccessLevel),
+		}
+		err := glcli.client.Request(http.MethodPatch, path+"/"+url.PathEscape(item.Name), body, nil)
+		if err != nil {
+			log.Fatalf("Cannot update protection of branch %s: %s", item.Name, err)
+		}
+	}
+	if len(toAdd) == 0 && len(toUpdate) == 0 {
+		log.Print("No branch protection to set")
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, name := range toDelete {
+			err := glcli.client.Request(http.MethodDelete, path+"/"+url.PathEscape(name), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot unprotect branch %s: %s", name, err)
+			}
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d branch(es) may be unprotected, but delete flag in command line is not set", len(toDelete))
+	}
+}
+
+func (glcli *GLCli) protectTag(item ProtectedTag) error {
+	body := map[string]any{
+		"name":                item.Name,
+		"create_access_level": item.CreateAccessLevel,
+	}
+	return glcli.client.Request(http.MethodPost, protectedTagsPath(glcli.ProjectId), body, nil)
+}
+
+// replaceTagProtection unprotects the tag and protects it again with the
+// access level of item. When the new protection fails, the previous access
+// level is restored, so the tag is not left unprotected.
+func (glcli *GLCli) replaceTagProtection(item ProtectedTag, previous ProtectedTag) error {
+	err := glcli.client.Request(http.MethodDelete, protectedTagsPath(glcli.ProjectId)+"/"+url.PathEscape(item.Name), nil, nil)
+	if err != nil {
+		return err
+	}
+	err = glcli.protectTag(item)
+	if err == nil {
+		return nil
+	}
+	restoreErr := glcli.protectTag(previous)
+	if restoreErr != nil {
+		return fmt.Errorf("%w, and tag is left unprotected as previous protection cannot be restored: %s", err, restoreErr)
+	}
+	return fmt.Errorf("%w, previous protection is restored", err)
+}
+
+// syncProtectedTags applies protected tags on the project. Gitlab cannot
+// update protected tags, so they are unprotected and protected again. Tags
+// missing in the file are only unprotected in delete mode.
+func (glcli *GLCli) syncProtectedTags(data []ProtectedTag, gitlab []GitlabProtectedTag) {
+	path := protectedTagsPath(glcli.ProjectId)
+	toAdd, toUpdate, toDelete := CompareProtectedTags(data, gitlab)
+	glcli.summary.ProtectedTags.count(len(toAdd), len(toUpdate), len(toDelete), glcli.Config.DeleteMode)
+	current := make(map[string]ProtectedTag)
+	for _, item := range gitlab {
+		current[item.Name] = item.Tag()
+	}
+	for _, item := range toAdd {
+		log.Printf("Tag %s should be protected", item.Name)
+		if !glcli.Config.DryrunMode {
+			err := glcli.protectTag(item)
+			if err != nil {
+				log.Fatalf("Cannot protect tag %s: %s", item.Name, err)
+			}
+		}
+	}
+	for _, item := range toUpdate {
+		log.Printf("Protection of tag %s should be updated", item.Name)
+		if !glcli.Config.DryrunMode {
+			err := glcli.replaceTagProtection(item, current[item.Name])
+			if err != nil {
+				log.Fatalf("Cannot update protection of tag %s: %s", item.Name, err)
+			}
+		}
+	}
+	if len(toAdd) == 0 && len(toUpdate) == 0 {
+		log.Print("No tag protection to set")
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, name := range toDelete {
+			err := glcli.client.Request(http.MethodDelete, path+"/"+url.PathEscape(name), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot unprotect tag %s: %s", name, err)
+			}
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d tag(s) may be unprotected, but delete flag in command line is not set", len(toDelete))
+	}
+}
+
+// syncProtected applies the protected file on the project.
+func (glcli *GLCli) syncProtected(filename string) {
+	data, err := ImportProtectedFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import protected file: %s", err)
+	}
+	branches, tags := glcli.getProtected()
+	glcli.syncProtectedBranches(data.Branches, branches)
+	glcli.syncProtectedTags(data.Tags, tags)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestImportProtectedFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		`{"branches": [{"name": "main"}, {"name": "release/*", "push_access_level": 0, "merge_access_level": 30}], "tags": [{"name": "v*"}]}`: true,
+		`{"branches": [{"name": "main", "push_access_level": 50}]}`:                                                                           false,
+		`{"branches": [{"name": "main"}, {"name": "main"}]}`:                                                                                  false,
+		`{"tags": [{"create_access_level": 40}]}`:                                                                                             false,
+	}
+	for content, valid := range tests {
+		filename := filepath.Join(dir, "protected.json")
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ImportProtectedFile(filename)
+		if (err == nil) != valid {
+			t.Errorf(`TestImportProtectedFile(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+
+	filename := filepath.Join(dir, "protected.json")
+	err := os.WriteFile(filename, []byte(`{"branches": [{"name": "main", "push_access_level": 0}], "tags": [{"name": "v*"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ImportProtectedFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProtectedBranch{Name: "main", PushAccessLevel: accessLevelNoOne, MergeAccessLevel: accessLevelMaintainer}
+	if data.Branches[0] != want {
+		t.Errorf(`TestImportProtectedFile(branch defaults) = %v, want %v`, data.Branches[0], want)
+	}
+	if data.Tags[0].CreateAccessLevel != accessLevelMaintainer {
+		t.Errorf(`TestImportProtectedFile(tag default) = %d, want %d`, data.Tags[0].CreateAccessLevel, accessLevelMaintainer)
+	}
+}
+
+func TestCompareProtectedBranches(t *testing.T) {
+	var gitlab []GitlabProtectedBranch
+	err := json.Unmarshal([]byte(`[
+		{"name": "main", "push_access_levels": [{"id": 1, "access_level": 40}, {"id": 2, "access_level": 30, "user_id": 12}], "merge_access_levels": [{"id": 3, "access_level": 30}], "allow_force_push": false},
+		{"name": "develop", "push_access_levels": [{"id": 4, "access_level": 30}], "merge_access_levels": [{"id": 5, "access_level": 30}], "allow_force_push": false},
+		{"name": "legacy", "push_access_levels": [{"id": 6, "access_level": 0}], "merge_access_levels": [{"id": 7, "access_level": 40}], "allow_force_push": false}
+	]`), &gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []ProtectedBranch{
+		{Name: "main", PushAccessLevel: 40, MergeAccessLevel: 30},
+		{Name: "develop", PushAccessLevel: 30, MergeAccessLevel: 30, AllowForcePush: true},
+		{Name: "release/*", PushAccessLevel: 0, MergeAccessLevel: 40},
+	}
+	toAdd, toUpdate, toDelete := CompareProtectedBranches(data, gitlab)
+	if len(toAdd) != 1 || toAdd[0].Name != "release/*" {
+		t.Errorf(`TestCompareProtectedBranches(branches to add) = %v, want only release/*`, toAdd)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].Name != "develop" {
+		t.Errorf(`TestCompareProtectedBranches(branches to update) = %v, want only develop`, toUpdate)
+	}
+	if len(toDelete) != 1 || toDelete[0] != "legacy" {
+		t.Errorf(`TestCompareProtectedBranches(branches to delete) = %v, want only legacy`, toDelete)
+	}
+}
+
+func TestCompareProtectedTags(t *testing.T) {
+	gitlab := []GitlabProtectedTag{
+		{Name: "v*", CreateAccessLevels: []accessRule{{Id: 1, DeployAccess: DeployAccess{AccessLevel: 40}}}},
+		{Name: "release-*", CreateAccessLevels: []accessRule{{Id: 2, DeployAccess: DeployAccess{AccessLevel: 40}}}},
+	}
+	data := []ProtectedTag{
+		{Name: "v*", CreateAccessLevel: 40},
+		{Name: "release-*", CreateAccessLevel: 30},
+		{Name: "stable", CreateAccessLevel: 60},
+	}
+	toAdd, toUpdate, toDelete := CompareProtectedTags(data, gitlab)
+	if len(toAdd) != 1 || toAdd[0].Name != "stable" {
+		t.Errorf(`TestCompareProtectedTags(tags to add) = %v, want only stable`, toAdd)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].Name != "release-*" {
+		t.Errorf(`TestCompareProtectedTags(tags to update) = %v, want only release-*`, toUpdate)
+	}
+	if len(toDelete) != 0 {
+		t.Errorf(`TestCompareProtectedTags(tags to delete) = %v, want none`, toDelete)
+	}
+}
+
+func TestRoleRuleUpdate(t *testing.T) {
+	current := []accessRule{
+		{Id: 1, DeployAccess: DeployAccess{AccessLevel: 40}},
+		{Id: 2, DeployAccess: DeployAccess{AccessLevel: 30, UserId: 12}},
+	}
+	rules := roleRuleUpdate(current, accessLevelMaintainer)
+	if len(rules) != 0 {
+		t.Errorf(`TestRoleRuleUpdate(same level) = %v, want no rule`, rules)
+	}
+	rules = roleRuleUpdate(current, accessLevelNoOne)
+	if len(rules) != 2 || rules[0]["id"] != 1 || rules[0]["_destroy"] != true || rules[1]["access_level"] != accessLevelNoOne {
+		t.Errorf(`TestRoleRuleUpdate(no one) = %v, want role rule 1 destroyed and no one access level added`, rules)
+	}
+	content, err := json.Marshal(rules[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != `{"access_level":0}` {
+		t.Errorf(`TestRoleRuleUpdate(no one body) = %s, want {"access_level":0}`, content)
+	}
+}
+
+func TestGLCliReplaceTagProtection(t *testing.T) {
+	var requests []string
+	allowed := map[string]bool{`"create_access_level":40`: true}
+	server, rec := newRecordingServer(t, nil)
+	rec.status = func(request string, body map[string]any) int {
+		if !strings.HasPrefix(request, http.MethodPost) {
+			requests = append(requests, http.MethodDelete)
+			return http.StatusOK
+		}
+		level := `"create_access_level":` + strconv.Itoa(int(body["create_access_level"].(float64)))
+		requests = append(requests, http.MethodPost+" "+level)
+		if !allowed[level] {
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusOK
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	item := ProtectedTag{Name: "v*", CreateAccessLevel: accessLevelDeveloper}
+	previous := ProtectedTag{Name: "v*", CreateAccessLevel: accessLevelMaintainer}
+
+	err := glcli.replaceTagProtection(item, previous)
+	want := []string{"DELETE", `POST "create_access_level":30`, `POST "create_access_level":40`}
+	if err == nil || !strings.Contains(err.Error(), "previous protection is restored") {
+		t.Errorf(`TestGLCliReplaceTagProtection(restored) = %v, want previous protection restored`, err)
+	}
+	if strings.Join(requests, ", ") != strings.Join(want, ", ") {
+		t.Errorf(`TestGLCliReplaceTagProtection(requests) = %v, want %v`, requests, want)
+	}
+
+	delete(allowed, `"create_access_level":40`)
+	err = glcli.replaceTagProtection(item, previous)
+	if err == nil || !strings.Contains(err.Error(), "left unprotected") {
+		t.Errorf(`TestGLCliReplaceTagProtection(not restored) = %v, want tag left unprotected`, err)
+	}
+
+	allowed[`"create_access_level":30`] = true
+	requests = nil
+	err = glcli.replaceTagProtection(item, previous)
+	if err != nil || len(requests) != 2 {
+		t.Errorf(`TestGLCliReplaceTagProtection(updated) = %v with %v, want nil with 2 requests`, err, requests)
+	}
+}
+
+func TestGLCliSyncProtected(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/protected_branches": `[{"name": "main", "push_access_levels": [{"id": 5, "access_level": 40}], "merge_access_levels": [{"id": 6, "access_level": 40}]},
+			{"name": "release/*", "push_access_levels": [{"id": 7, "access_level": 40}], "merge_access_levels": [{"id": 8, "access_level": 40}]}]`,
+		"GET /api/v4/projects/51/protected_tags": `[{"name": "v*", "create_access_levels": [{"id": 9, "access_level": 40}]}, {"name": "old-*", "create_access_levels": [{"id": 10, "access_level": 40}]}]`,
+	})
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "protected.json")
+	err := os.WriteFile(filename, []byte(`{"branches": [{"name": "main", "push_access_level": 0}, {"name": "develop", "push_access_level": 30}],
+		"tags": [{"name": "v*", "create_access_level": 30}, {"name": "rc*"}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.syncProtected(filename)
+	rec.expectWrites(t, "TestGLCliSyncProtected(dry run requests)", nil)
+
+	glcli.Config.DryrunMode = false
+	glcli.syncProtected(filename)
+	patch, err := json.Marshal(rec.bodies["PATCH /api/v4/projects/51/protected_branches/main"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.expectWrites(t, "TestGLCliSyncProtected(requests)", []string{
+		"DELETE /api/v4/projects/51/protected_branches/release/*",
+		"DELETE /api/v4/projects/51/protected_tags/old-*",
+		"DELETE /api/v4/projects/51/protected_tags/v*",
+		"PATCH /api/v4/projects/51/protected_branches/main",
+		"POST /api/v4/projects/51/protected_branches",
+		"POST /api/v4/projects/51/protected_tags",
+		"POST /api/v4/projects/51/protected_tags",
+	})
+	if !strings.Contains(string(patch), `{"_destroy":true,"id":5}`) || !strings.Contains(string(patch), `{"access_level":0}`) || strings.Contains(string(patch), `"id":6`) {
+		t.Errorf(`TestGLCliSyncProtected(branch update) = %s, want push rule 5 replaced by no one and merge rule kept`, patch)
+	}
+
+	glcli.Config.DeleteMode = false
+	glcli.syncProtected(filename)
+	for _, request := range rec.writes() {
+		if strings.Contains(request, "release") || strings.Contains(request, "old-") {
+			t.Errorf(`TestGLCliSyncProtected(request without delete mode) = %s, want no unprotection`, request)
+		}
+	}
+
+	exported := filepath.Join(dir, "exported.json")
+	glcli.exportProtected(exported)
+	data, err := ImportProtectedFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Branches) != 2 || len(data.Tags) != 2 || data.Branches[0].Name != "main" || data.Tags[0].Name != "old-*" {
+		t.Errorf(`TestGLCliSyncProtected(exported) = %v, want the Gitlab branches and tags sorted by name`, data)
+	}
+}
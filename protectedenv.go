@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+)
+
+// Access levels allowed to deploy to a protected environment.
+const (
+	accessLevelDeveloper  = 30
+	accessLevelMaintainer = 40
+	accessLevelAdmin      = 60
+)
+
+// DeployAccess is allowed to deploy to a protected environment: a role given
+// by its access level, a user or a group.
+type DeployAccess struct {
+	AccessLevel int `json:"access_level,omitempty"`
+	UserId      int `json:"user_id,omitempty"`
+	GroupId     int `json:"group_id,omitempty"`
+}
+
+func (access DeployAccess) String() string {
+	switch {
+	case access.UserId != 0:
+		return fmt.Sprintf("user %d", access.UserId)
+	case access.GroupId != 0:
+		return fmt.Sprintf("group %d", access.GroupId)
+	}
+	return fmt.Sprintf("access level %d", access.AccessLevel)
+}
+
+// EnvProtection is the protection of an env declared in env file.
+type EnvProtection struct {
+	DeployAccessLevels    []DeployAccess `json:"deploy_access_levels"`
+	RequiredApprovalCount int            `json:"required_approval_count,omitempty"`
+}
+
+// Validate checks that each deploy access gives exactly one of access level,
+// user and group. A nil protection is valid.
+func (protection *EnvProtection) Validate() error {
+	if protection == nil {
+		return nil
+	}
+	if len(protection.DeployAccessLevels) == 0 {
+		return errors.New("at least one deploy access level is required")
+	}
+	for _, access := range protection.DeployAccessLevels {
+		given := 0
+		for _, value := range []int{access.AccessLevel, access.UserId, access.GroupId} {
+			if value != 0 {
+				given++
+			}
+		}
+		if given != 1 {
+			return errors.New("deploy access level must give one of access_level, user_id or group_id")
+		}
+		if access.AccessLevel != 0 && !slices.Contains([]int{accessLevelDeveloper, accessLevelMaintainer, accessLevelAdmin}, access.AccessLevel) {
+			return fmt.Errorf("access level %d is not allowed (must be %d, %d or %d)", access.AccessLevel, accessLevelDeveloper, accessLevelMaintainer, accessLevelAdmin)
+		}
+	}
+	if protection.RequiredApprovalCount < 0 {
+		return errors.New("required approval count cannot be negative")
+	}
+	return nil
+}
+
+// Equal tells if both protections give the same deploy access levels, in any
+// order, and the same required approval count.
+func (protection *EnvProtection) Equal(other *EnvProtection) bool {
+	if protection == nil || other == nil {
+		return protection == other
+	}
+	if protection.RequiredApprovalCount != other.RequiredApprovalCount {
+		return false
+	}
+	return slices.Equal(sortedDeployAccess(protection.DeployAccessLevels), sortedDeployAccess(other.DeployAccessLevels))
+}
+
+func sortedDeployAccess(levels []DeployAccess) []DeployAccess {
+	sorted := slices.Clone(levels)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	return slices.Compact(sorted)
+}
+
+// ProtectedEnv is a protected environment as returned by Gitlab API.
+type ProtectedEnv struct {
+	Name                  string       `json:"name"`
+	DeployAccessLevels    []accessRule `json:"deploy_access_levels"`
+	RequiredApprovalCount int          `json:"required_approval_count"`
+}
+
+// accessRule is an access rule of a protected environment, branch or tag as
+// returned by Gitlab API. Destroy removes the rule on update. A new rule has
+// no id, which must not be sent.
+type accessRule struct {
+	Id int `json:"id,omitempty"`
+	DeployAccess
+	Destroy bool `json:"_destroy,omitempty"`
+}
+
+// access returns the deploy access in the env file form. Gitlab gives an
+// access level to user and group rules too, which is dropped.
+func (level accessRule) access() DeployAccess {
+	access := level.DeployAccess
+	if access.UserId != 0 || access.GroupId != 0 {
+		access.AccessLevel = 0
+	}
+	return access
+}
+
+// Protection returns the protection in the env file form.
+func (env ProtectedEnv) Protection() *EnvProtection {
+	protection := EnvProtection{RequiredApprovalCount: env.RequiredApprovalCount}
+	for _, item := range env.DeployAccessLevels {
+		protection.DeployAccessLevels = append(protection.DeployAccessLevels, item.access())
+	}
+	return &protection
+}
+
+// EnvProtectionChanges lists the protections to create, update and remove.
+type EnvProtectionChanges struct {
+	Protect   []EnvFileData
+	Update    []EnvFileData
+	Unprotect []string
+}
+
+// CompareEnvProtections compares the protection of envs in env file with the
+// protected envs on Gitlab. Only envs of env file are considered, so an env
+// without protection in env file is unprotected.
+func CompareEnvProtections(data []EnvFileData, protected []ProtectedEnv) EnvProtectionChanges {
+	var changes EnvProtectionChanges
+	current := make(map[string]ProtectedEnv)
+	for _, item := range protected {
+		current[item.Name] = item
+	}
+	for _, item := range data {
+		gitlab, found := current[item.Name]
+		switch {
+		case item.Protection == nil && found:
+			changes.Unprotect = append(changes.Unprotect, item.Name)
+		case item.Protection == nil:
+		case !found:
+			changes.Protect = append(changes.Protect, item)
+		case !item.Protection.Equal(gitlab.Protection()):
+			changes.Update = append(changes.Update, item)
+		}
+	}
+	return changes
+}
+
+// withEnvProtections returns envs with the protection of the protected envs.
+func withEnvProtections(data []EnvFileData, protected []ProtectedEnv) []EnvFileData {
+	protections := make(map[string]*EnvProtection)
+	for _, item := range protected {
+		protections[item.Name] = item.Protection()
+	}
+	for idx := range data {
+		data[idx].Protection = protections[data[idx].Name]
+	}
+	return data
+}
+
+func protectedEnvsPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/protected_environments"
+}
+
+// getProtectedEnvs returns the protected envs of the project, and tells if
+// protected envs are available. They are a Premium feature, Gitlab returns 403
+// or 404 when they are not available.
+func (glcli *GLCli) getProtectedEnvs() ([]ProtectedEnv, bool) {
+	var data []ProtectedEnv
+	var gitlabErr *GitlabError
+	err := glcli.client.GetAll(protectedEnvsPath(glcli.ProjectId), &data)
+	if errors.As(err, &gitlabErr) && (gitlabErr.StatusCode == http.StatusForbidden || gitlabErr.StatusCode == http.StatusNotFound) {
+		log.Printf("Protected envs are not available on this project: %s", err)
+		return nil, false
+	}
+	if err != nil {
+		log.Fatalf("Cannot fetch protected envs from gitlab: %s", err)
+	}
+	return data, true
+}
+
+// protectEnv protects an env of the project.
+func (glcli *GLCli) protectEnv(item EnvFileData) error {
+	body := map[string]any{
+		"name":                    item.Name,
+		"deploy_access_levels":    item.Protection.DeployAccessLevels,
+		"required_approval_count": item.Protection.RequiredApprovalCount,
+	}
+	err := glcli.client.Request(http.MethodPost, protectedEnvsPath(glcli.ProjectId), body, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Protect env %s", item.Name)
+	return nil
+}
+
+// updateEnvProtection replaces the deploy access levels and the required
+// approval count of a protected env. Deploy access levels which are no longer
+// wanted are destroyed by id, as Gitlab API requires.
+func (glcli *GLCli) updateEnvProtection(item EnvFileData, current ProtectedEnv) error {
+	wanted := sortedDeployAccess(item.Protection.DeployAccessLevels)
+	levels := []accessRule{}
+	existing := make(map[DeployAccess]bool)
+	for _, level := range current.DeployAccessLevels {
+		access := level.access()
+		existing[access] = true
+		if !slices.Contains(wanted, access) {
+			levels = append(levels, accessRule{Id: level.Id, Destroy: true})
+		}
+	}
+	for _, access := range wanted {
+		if !existing[access] {
+			levels = append(levels, accessRule{DeployAccess: access})
+		}
+	}
+	body := map[string]any{
+		"deploy_access_levels":    levels,
+		"required_approval_count": item.Protection.RequiredApprovalCount,
+	}
+	err := glcli.client.Request(http.MethodPut, protectedEnvsPath(glcli.ProjectId)+"/"+url.PathEscape(item.Name), body, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Update protection of env %s", item.Name)
+	return nil
+}
+
+// unprotectEnv removes the protection of an env of the project.
+func (glcli *GLCli) unprotectEnv(name string) error {
+	err := glcli.client.Request(http.MethodDelete, protectedEnvsPath(glcli.ProjectId)+"/"+url.PathEscape(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Unprotect env %s", name)
+	return nil
+}
+
+// syncEnvProtections applies the protections of env file on Gitlab. Protections
+// are only removed in delete mode. When protected envs are not available, it
+// fails only if the env file declares a protection.
+func (glcli *GLCli) syncEnvProtections(data []EnvFileData) {
+	protected, available := glcli.getProtectedEnvs()
+	if !available {
+		for _, item := range data {
+			if item.Protection != nil {
+				log.Fatalf("Cannot protect env %s because protected envs are not available", item.Name)
+			}
+		}
+		return
+	}
+	current := make(map[string]ProtectedEnv)
+	for _, item := range protected {
+		current[item.Name] = item
+	}
+	changes := CompareEnvProtections(data, protected)
+	glcli.summary.Envs.count(0, len(changes.Protect)+len(changes.Update), len(changes.Unprotect), glcli.Config.DeleteMode)
+	for _, item := range changes.Protect {
+		log.Printf("Env %s should be protected", item.Name)
+		if !glcli.Config.DryrunMode {
+			err := glcli.protectEnv(item)
+			if err != nil {
+				log.Fatalf("Cannot protect env %s: %s", item.Name, err)
+			}
+		}
+	}
+	for _, item := range changes.Update {
+		log.Printf("Protection of env %s should be updated", item.Name)
+		if !glcli.Config.DryrunMode {
+			err := glcli.updateEnvProtection(item, current[item.Name])
+			if err != nil {
+				log.Fatalf("Cannot update protection of env %s: %s", item.Name, err)
+			}
+		}
+	}
+	if len(changes.Protect) == 0 && len(changes.Update) == 0 {
+		log.Print("No env protection to set")
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, name := range changes.Unprotect {
+			err := glcli.unprotectEnv(name)
+			if err != nil {
+				log.Fatalf("Cannot unprotect env %s: %s", name, err)
+			}
+		}
+	} else if len(changes.Unprotect) > 0 {
+		log.Printf("%d env(s) may be unprotected, but delete flag in command line is not set", len(changes.Unprotect))
+	}
+}
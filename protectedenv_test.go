@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvProtectionValidate(t *testing.T) {
+	var protection *EnvProtection
+	if protection.Validate() != nil {
+		t.Errorf(`TestEnvProtectionValidate(nil) = %s, want nil`, protection.Validate())
+	}
+	tests := map[string]bool{
+		`{"deploy_access_levels": [{"access_level": 40}, {"user_id": 12}, {"group_id": 7}], "required_approval_count": 1}`: true,
+		`{"deploy_access_levels": []}`:                                                    false,
+		`{"deploy_access_levels": [{"access_level": 20}]}`:                                false,
+		`{"deploy_access_levels": [{"access_level": 40, "user_id": 12}]}`:                 false,
+		`{"deploy_access_levels": [{"access_level": 40}], "required_approval_count": -1}`: false,
+	}
+	for content, valid := range tests {
+		protection = &EnvProtection{}
+		err := json.Unmarshal([]byte(content), protection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = protection.Validate()
+		if (err == nil) != valid {
+			t.Errorf(`TestEnvProtectionValidate(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+}
+
+func TestCompareEnvProtections(t *testing.T) {
+	var protected []ProtectedEnv
+	err := json.Unmarshal([]byte(`[
+		{"name": "production", "deploy_access_levels": [{"id": 1, "access_level": 40, "user_id": 12}, {"id": 2, "access_level": 40}], "required_approval_count": 1},
+		{"name": "staging", "deploy_access_levels": [{"id": 3, "access_level": 30}]},
+		{"name": "review", "deploy_access_levels": [{"id": 4, "access_level": 40}]},
+		{"name": "legacy", "deploy_access_levels": [{"id": 5, "access_level": 40}]}
+	]`), &protected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []EnvFileData
+	err = json.Unmarshal([]byte(`[
+		{"name": "production", "protection": {"deploy_access_levels": [{"access_level": 40}, {"user_id": 12}], "required_approval_count": 1}},
+		{"name": "staging", "protection": {"deploy_access_levels": [{"access_level": 40}]}},
+		{"name": "review"},
+		{"name": "qa", "protection": {"deploy_access_levels": [{"group_id": 7}]}}
+	]`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := CompareEnvProtections(data, protected)
+	if len(changes.Protect) != 1 || changes.Protect[0].Name != "qa" {
+		t.Errorf(`TestCompareEnvProtections(protect) = %v, want only qa`, changes.Protect)
+	}
+	if len(changes.Update) != 1 || changes.Update[0].Name != "staging" {
+		t.Errorf(`TestCompareEnvProtections(update) = %v, want only staging`, changes.Update)
+	}
+	if len(changes.Unprotect) != 1 || changes.Unprotect[0] != "review" {
+		t.Errorf(`TestCompareEnvProtections(unprotect) = %v, want only review`, changes.Unprotect)
+	}
+
+	envs := withEnvProtections(data, protected)
+	if envs[2].Protection == nil || envs[3].Protection != nil {
+		t.Errorf(`TestCompareEnvProtections(export protections) = %v, %v, want review protected only`, envs[2].Protection, envs[3].Protection)
+	}
+}
+
+func TestEnvFileProtection(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "envs.json")
+	var env EnvFileData
+	env.Name = "production"
+	env.Protection = &EnvProtection{DeployAccessLevels: []DeployAccess{{AccessLevel: accessLevelMaintainer}}, RequiredApprovalCount: 2}
+	err := ExportEnvFile(filename, []EnvFileData{env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ImportEnvFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 || !data[0].Protection.Equal(env.Protection) {
+		t.Errorf(`TestEnvFileProtection(protection) = %v, want %v`, data, env.Protection)
+	}
+
+	env.Protection.DeployAccessLevels = []DeployAccess{{AccessLevel: 10}}
+	err = ExportEnvFile(filename, []EnvFileData{env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ImportEnvFile(filename)
+	if err == nil {
+		t.Errorf(`TestEnvFileProtection(invalid access level) = nil, want error`)
+	}
+}
+
+func TestProtectedEnvsNotAvailable(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message": "403 Forbidden"}`))
+	}))
+	defer server.Close()
+	glcli := GLCli{}
+	glcli.ProjectId = "12"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	protected, available := glcli.getProtectedEnvs()
+	if available || protected != nil {
+		t.Errorf(`TestProtectedEnvsNotAvailable(get) = %v, %v, want nil, false`, protected, available)
+	}
+	var env EnvFileData
+	env.Name = "production"
+	glcli.syncEnvProtections([]EnvFileData{env})
+	if requests != 2 {
+		t.Errorf(`TestProtectedEnvsNotAvailable(count requests) = %d, want %d`, requests, 2)
+	}
+}
+
+func TestGLCliUpdateEnvProtection(t *testing.T) {
+	server, rec := newRecordingServer(t, nil)
+	glcli := GLCli{}
+	glcli.ProjectId = "12"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	var env EnvFileData
+	env.Name = "production"
+	env.Protection = &EnvProtection{DeployAccessLevels: []DeployAccess{{AccessLevel: accessLevelMaintainer}, {GroupId: 9}}, RequiredApprovalCount: 1}
+	var current ProtectedEnv
+	err := json.Unmarshal([]byte(`{"name": "production", "required_approval_count": 0, "deploy_access_levels": [
+		{"id": 3, "access_level": 40}, {"id": 4, "access_level": 30, "user_id": 5}]}`), &current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = glcli.updateEnvProtection(env, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := rec.bodies["PUT /api/v4/projects/12/protected_environments/production"]
+	content, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"deploy_access_levels":[{"_destroy":true,"id":4},{"group_id":9}],"required_approval_count":1}`
+	if string(content) != want {
+		t.Errorf(`TestGLCliUpdateEnvProtection(body) = %s, want %s`, content, want)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ScheduleVar is a variable of a pipeline schedule. As for vars, its value
+// can be encrypted or given by a value reference.
+type ScheduleVar struct {
+	Key          string `json:"key"`
+	Value        string `json:"value"`
+	ValueRef     string `json:"value_ref,omitempty"`
+	VariableType string `json:"variable_type,omitempty"`
+}
+
+// ScheduleData is a pipeline schedule of schedule file. Schedules are
+// matched by description.
+type ScheduleData struct {
+	Description  string        `json:"description"`
+	Ref          string        `json:"ref"`
+	Cron         string        `json:"cron"`
+	CronTimezone string        `json:"cron_timezone,omitempty"`
+	Active       bool          `json:"active"`
+	Variables    []ScheduleVar `json:"variables"`
+}
+
+// GitlabSchedule is a pipeline schedule as returned by Gitlab API.
+type GitlabSchedule struct {
+	Id int `json:"id"`
+	ScheduleData
+}
+
+// ScheduleUpdate is a schedule to update with its Gitlab id and variables.
+type ScheduleUpdate struct {
+	ScheduleData
+	Current GitlabSchedule
+}
+
+// sameRef tells if both refs give the same branch or tag. Gitlab returns the
+// ref as it was given, with or without the refs/heads/ or refs/tags/ prefix,
+// so a short ref matches both full refs, while two full refs must be equal.
+func sameRef(left string, right string) bool {
+	if strings.HasPrefix(left, "refs/") && strings.HasPrefix(right, "refs/") {
+		return left == right
+	}
+	short := func(ref string) string {
+		ref = strings.TrimPrefix(ref, "refs/heads/")
+		return strings.TrimPrefix(ref, "refs/tags/")
+	}
+	return short(left) == short(right)
+}
+
+// normalized returns the schedule with the Gitlab defaults and sorted
+// variables, to be compared or written. The ref is kept as declared.
+func (schedule ScheduleData) normalized() ScheduleData {
+	if schedule.CronTimezone == "" {
+		schedule.CronTimezone = "UTC"
+	}
+	schedule.Variables = slices.Clone(schedule.Variables)
+	for idx := range schedule.Variables {
+		if schedule.Variables[idx].VariableType == "" {
+			schedule.Variables[idx].VariableType = varTypeEnv
+		}
+	}
+	sort.Slice(schedule.Variables, func(i, j int) bool {
+		return schedule.Variables[i].Key < schedule.Variables[j].Key
+	})
+	if schedule.Variables == nil {
+		schedule.Variables = []ScheduleVar{}
+	}
+	return schedule
+}
+
+// Equal tells if both schedules have the same attributes and variables.
+func (schedule ScheduleData) Equal(other ScheduleData) bool {
+	left := schedule.normalized()
+	right := other.normalized()
+	return sameRef(left.Ref, right.Ref) && left.Cron == right.Cron && left.CronTimezone == right.CronTimezone &&
+		left.Active == right.Active && slices.Equal(left.Variables, right.Variables)
+}
+
+// ImportScheduleFile reads a schedule file and checks that each schedule has
+// a unique description, a ref and a cron.
+func ImportScheduleFile(filename string) ([]ScheduleData, error) {
+	var data []ScheduleData
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	seen := make(map[string]bool)
+	for idx, item := range data {
+		if item.Description == "" {
+			return nil, fmt.Errorf("schedule %d of %s has no description", idx+1, filename)
+		}
+		if seen[item.Description] {
+			return nil, fmt.Errorf("schedule %s is defined twice in %s", item.Description, filename)
+		}
+		seen[item.Description] = true
+		if item.Ref == "" || item.Cron == "" {
+			return nil, fmt.Errorf("schedule %s of %s requires ref and cron", item.Description, filename)
+		}
+		for _, variable := range item.Variables {
+			if variable.ValueRef != "" && variable.Value != "" {
+				return nil, fmt.Errorf("variable %s of schedule %s of %s cannot have both value and value_ref", variable.Key, item.Description, filename)
+			}
+		}
+	}
+	return data, nil
+}
+
+// ExportScheduleFile writes schedules to filename, sorted by description.
+func ExportScheduleFile(filename string, data []ScheduleData) error {
+	sorted := make([]ScheduleData, 0, len(data))
+	for _, item := range data {
+		sorted = append(sorted, item.normalized())
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Description < sorted[j].Description
+	})
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// CompareSchedules compares the schedules of schedule file with the Gitlab
+// ones, matched by description. Gitlab schedules sharing a description cannot
+// be matched and give an error.
+func CompareSchedules(data []ScheduleData, gitlab []GitlabSchedule) ([]ScheduleData, []ScheduleUpdate, []GitlabSchedule, error) {
+	var toAdd []ScheduleData
+	var toUpdate []ScheduleUpdate
+	var toDelete []GitlabSchedule
+	current := make(map[string]GitlabSchedule)
+	for _, item := range gitlab {
+		if _, found := current[item.Description]; found {
+			return nil, nil, nil, fmt.Errorf("several Gitlab schedules are described as %s", item.Description)
+		}
+		current[item.Description] = item
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Description] = true
+		schedule, found := current[item.Description]
+		if !found {
+			toAdd = append(toAdd, item)
+		} else if !item.Equal(schedule.ScheduleData) {
+			toUpdate = append(toUpdate, ScheduleUpdate{ScheduleData: item, Current: schedule})
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Description] {
+			toDelete = append(toDelete, item)
+		}
+	}
+	return toAdd, toUpdate, toDelete, nil
+}
+
+func schedulesPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/pipeline_schedules"
+}
+
+// getSchedules returns the pipeline schedules of the project with their
+// variables, which are only given by the schedule details.
+func (glcli *GLCli) getSchedules() []GitlabSchedule {
+	var list []GitlabSchedule
+	err := glcli.client.GetAll(schedulesPath(glcli.ProjectId), &list)
+	if err != nil {
+		log.Fatalf("Cannot fetch pipeline schedules from gitlab: %s", err)
+	}
+	schedules := make([]GitlabSchedule, 0, len(list))
+	for _, item := range list {
+		var schedule GitlabSchedule
+		err = glcli.client.Request(http.MethodGet, fmt.Sprintf("%s/%d", schedulesPath(glcli.ProjectId), item.Id), nil, &schedule)
+		if err != nil {
+			log.Fatalf("Cannot fetch pipeline schedule %s from gitlab: %s", item.Description, err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules
+}
+
+// scheduleBody returns the attributes of schedule sent to Gitlab API.
+func scheduleBody(schedule ScheduleData) map[string]any {
+	schedule = schedule.normalized()
+	return map[string]any{
+		"description":   schedule.Description,
+		"ref":           schedule.Ref,
+		"cron":          schedule.Cron,
+		"cron_timezone": schedule.CronTimezone,
+		"active":        schedule.Active,
+	}
+}
+
+// syncScheduleVars sets the variables of the schedule id as declared, and
+// removes the other ones.
+func (glcli *GLCli) syncScheduleVars(id int, wanted []ScheduleVar, current []ScheduleVar) error {
+	path := fmt.Sprintf("%s/%d/variables", schedulesPath(glcli.ProjectId), id)
+	existing := make(map[string]ScheduleVar)
+	for _, item := range (ScheduleData{Variables: current}).normalized().Variables {
+		existing[item.Key] = item
+	}
+	keys := make(map[string]bool)
+	for _, item := range (ScheduleData{Variables: wanted}).normalized().Variables {
+		keys[item.Key] = true
+		old, found := existing[item.Key]
+		var err error
+		if !found {
+			err = glcli.client.Request(http.MethodPost, path, item, nil)
+		} else if old != item {
+			err = glcli.client.Request(http.MethodPut, path+"/"+url.PathEscape(item.Key), item, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot set variable %s: %w", item.Key, err)
+		}
+	}
+	for _, item := range current {
+		if !keys[item.Key] {
+			err := glcli.client.Request(http.MethodDelete, path+"/"+url.PathEscape(item.Key), nil, nil)
+			if err != nil {
+				return fmt.Errorf("cannot delete variable %s: %w", item.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleVarId returns the identifier of a variable of a schedule.
+func scheduleVarId(description string, key string) string {
+	return description + "/" + key
+}
+
+// resolveScheduleVars decrypts the encrypted values and resolves the value
+// references of the schedule variables of the schedule file filename.
+func (glcli *GLCli) resolveScheduleVars(filename string, data []ScheduleData) []ScheduleData {
+	for _, item := range data {
+		for idx, variable := range item.Variables {
+			var err error
+			if variable.ValueRef != "" {
+				item.Variables[idx].Value, err = glcli.getResolver().Resolve(fileRef(filename, variable.ValueRef))
+				item.Variables[idx].ValueRef = ""
+			} else if IsEncrypted(variable.Value) {
+				item.Variables[idx].Value, err = glcli.getCipher().Decrypt(variable.Value)
+			}
+			if err != nil {
+				log.Fatalf("Cannot get value of variable %s of pipeline schedule %s: %s", variable.Key, item.Description, err)
+			}
+		}
+	}
+	return data
+}
+
+// protectScheduleVars keeps the value references and the encrypted values of
+// the previous schedule file when the values are unchanged, and encrypts the
+// other values when encryption is active.
+func (glcli *GLCli) protectScheduleVars(data []ScheduleData, previous []ScheduleData) []ScheduleData {
+	old := make(map[string]ScheduleVar)
+	encrypt := glcli.encryptionIsActive(nil)
+	for _, item := range previous {
+		for _, variable := range item.Variables {
+			old[scheduleVarId(item.Description, variable.Key)] = variable
+			encrypt = encrypt || IsEncrypted(variable.Value)
+		}
+	}
+	for _, item := range data {
+		for idx, variable := range item.Variables {
+			previousVar, found := old[scheduleVarId(item.Description, variable.Key)]
+			if found && previousVar.ValueRef != "" {
+				item.Variables[idx].Value = ""
+				item.Variables[idx].ValueRef = previousVar.ValueRef
+				continue
+			}
+			if !encrypt || variable.Value == "" {
+				continue
+			}
+			if found && IsEncrypted(previousVar.Value) {
+				plain, err := glcli.getCipher().Decrypt(previousVar.Value)
+				if err == nil && plain == variable.Value {
+					item.Variables[idx].Value = previousVar.Value
+					continue
+				}
+			}
+			value, err := glcli.getCipher().Encrypt(variable.Value)
+			if err != nil {
+				log.Fatalf("Cannot encrypt value of variable %s of pipeline schedule %s: %s", variable.Key, item.Description, err)
+			}
+			item.Variables[idx].Value = value
+		}
+	}
+	return data
+}
+
+// exportSchedules writes the pipeline schedules of the project in filename.
+// The file is only written when the project has schedules or when it exists.
+// Variable values are encrypted like the values of secret vars, and the value
+// references of the previous file are kept.
+func (glcli *GLCli) exportSchedules(filename string) {
+	schedules := glcli.getSchedules()
+	var previous []ScheduleData
+	_, err := os.Stat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		if len(schedules) == 0 {
+			if glcli.Config.VerboseMode {
+				log.Printf("No pipeline schedule to export in %s file", filename)
+			}
+			return
+		}
+	} else {
+		previous, err = ImportScheduleFile(filename)
+		if err != nil {
+			log.Fatalf("Cannot import schedule file: %s", err)
+		}
+	}
+	data := make([]ScheduleData, 0, len(schedules))
+	for _, item := range schedules {
+		data = append(data, item.ScheduleData.normalized())
+	}
+	err = ExportScheduleFile(filename, glcli.protectScheduleVars(data, previous))
+	if err != nil {
+		log.Fatalf("Cannot export pipeline schedules to %s: %s", filename, err)
+	}
+}
+
+// syncSchedules applies the schedule file on the pipeline schedules of the
+// project. Schedules missing in the file are only deleted in delete mode.
+func (glcli *GLCli) syncSchedules(filename string) {
+	data, err := ImportScheduleFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import schedule file: %s", err)
+	}
+	data = glcli.resolveScheduleVars(filename, data)
+	toAdd, toUpdate, toDelete, err := CompareSchedules(data, glcli.getSchedules())
+	if err != nil {
+		log.Fatalf("Cannot compare pipeline schedules: %s", err)
+	}
+	glcli.summary.Schedules.count(len(toAdd), len(toUpdate), len(toDelete), glcli.Config.DeleteMode)
+	for _, item := range toAdd {
+		log.Printf("Pipeline schedule %s should be created", item.Description)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		var created GitlabSchedule
+		err = glcli.client.Request(http.MethodPost, schedulesPath(glcli.ProjectId), scheduleBody(item), &created)
+		if err == nil {
+			err = glcli.syncScheduleVars(created.Id, item.Variables, nil)
+		}
+		if err != nil {
+			log.Fatalf("Cannot create pipeline schedule %s: %s", item.Description, err)
+		}
+	}
+	if len(toAdd) == 0 {
+		log.Print("No pipeline schedule to insert")
+	}
+	for _, item := range toUpdate {
+		log.Printf("Pipeline schedule %s should be updated", item.Description)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		err = glcli.client.Request(http.MethodPut, fmt.Sprintf("%s/%d", schedulesPath(glcli.ProjectId), item.Current.Id), scheduleBody(item.ScheduleData), nil)
+		if err == nil {
+			err = glcli.syncScheduleVars(item.Current.Id, item.Variables, item.Current.Variables)
+		}
+		if err != nil {
+			log.Fatalf("Cannot update pipeline schedule %s: %s", item.Description, err)
+		}
+	}
+	if len(toUpdate) == 0 {
+		log.Print("No pipeline schedule to update")
+	}
+	if len(toDelete) == 0 {
+		log.Print("No pipeline schedule to delete")
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, item := range toDelete {
+			err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", schedulesPath(glcli.ProjectId), item.Id), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot delete pipeline schedule %s: %s", item.Description, err)
+			}
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d pipeline schedule(s) may be deleted, but delete flag in command line is not set", len(toDelete))
+	}
+}
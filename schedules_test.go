@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestImportScheduleFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]bool{
+		`[{"description": "Nightly", "ref": "main", "cron": "0 2 * * *", "active": true}]`:                                                    true,
+		`[{"ref": "main", "cron": "0 2 * * *"}]`:                                                                                              false,
+		`[{"description": "Nightly", "cron": "0 2 * * *"}]`:                                                                                   false,
+		`[{"description": "Nightly", "ref": "main", "cron": "0 2 * * *"}, {"description": "Nightly", "ref": "develop", "cron": "0 3 * * *"}]`: false,
+	}
+	idx := 0
+	for content, valid := range tests {
+		idx++
+		filename := filepath.Join(dir, "schedules"+strconv.Itoa(idx)+".json")
+		err := os.WriteFile(filename, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ImportScheduleFile(filename)
+		if (err == nil) != valid {
+			t.Errorf(`TestImportScheduleFile(%s) = %v, want valid %t`, content, err, valid)
+		}
+	}
+}
+
+func TestCompareSchedules(t *testing.T) {
+	var data []ScheduleData
+	err := json.Unmarshal([]byte(`[
+		{"description": "Nightly", "ref": "main", "cron": "0 2 * * *", "active": true, "variables": [{"key": "MODE", "value": "full"}]},
+		{"description": "Weekly", "ref": "main", "cron": "0 4 * * 0", "active": true},
+		{"description": "Release", "ref": "main", "cron": "0 6 1 * *", "active": false}
+	]`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gitlab []GitlabSchedule
+	err = json.Unmarshal([]byte(`[
+		{"id": 1, "description": "Nightly", "ref": "refs/heads/main", "cron": "0 2 * * *", "cron_timezone": "UTC", "active": true, "variables": [{"key": "MODE", "value": "full", "variable_type": "env_var"}]},
+		{"id": 2, "description": "Weekly", "ref": "main", "cron": "0 5 * * 0", "cron_timezone": "UTC", "active": true},
+		{"id": 3, "description": "Cleanup", "ref": "main", "cron": "0 1 * * *", "cron_timezone": "UTC", "active": true}
+	]`), &gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toAdd, toUpdate, toDelete, err := CompareSchedules(data, gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toAdd) != 1 || toAdd[0].Description != "Release" {
+		t.Errorf(`TestCompareSchedules(schedules to add) = %v, want only Release`, toAdd)
+	}
+	if len(toUpdate) != 1 || toUpdate[0].Current.Id != 2 {
+		t.Errorf(`TestCompareSchedules(schedules to update) = %v, want only Weekly`, toUpdate)
+	}
+	if len(toDelete) != 1 || toDelete[0].Id != 3 {
+		t.Errorf(`TestCompareSchedules(schedules to delete) = %v, want only Cleanup`, toDelete)
+	}
+
+	_, _, _, err = CompareSchedules(data, append(gitlab, gitlab[0]))
+	if err == nil {
+		t.Errorf(`TestCompareSchedules(duplicated description) = nil, want error`)
+	}
+}
+
+func TestSameRef(t *testing.T) {
+	tests := map[[2]string]bool{
+		{"main", "refs/heads/main"}:           true,
+		{"v1", "refs/tags/v1"}:                true,
+		{"refs/tags/v1", "refs/tags/v1"}:      true,
+		{"refs/heads/v1", "refs/tags/v1"}:     false,
+		{"main", "develop"}:                   false,
+		{"refs/heads/main", "refs/heads/dev"}: false,
+	}
+	for refs, want := range tests {
+		if sameRef(refs[0], refs[1]) != want {
+			t.Errorf(`TestSameRef(%s, %s) = %t, want %t`, refs[0], refs[1], !want, want)
+		}
+	}
+	body := scheduleBody(ScheduleData{Description: "Release", Ref: "refs/tags/v1", Cron: "0 6 * * *"})
+	if body["ref"] != "refs/tags/v1" {
+		t.Errorf(`TestSameRef(sent ref) = %v, want %s`, body["ref"], "refs/tags/v1")
+	}
+}
+
+func TestGLCliSyncScheduleVars(t *testing.T) {
+	server, rec := newRecordingServer(t, nil)
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	wanted := []ScheduleVar{{Key: "MODE", Value: "full"}, {Key: "TARGET", Value: "prod"}}
+	current := []ScheduleVar{{Key: "MODE", Value: "quick", VariableType: varTypeEnv}, {Key: "OLD", Value: "1", VariableType: varTypeEnv}}
+	err := glcli.syncScheduleVars(4, wanted, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.expectWrites(t, "TestGLCliSyncScheduleVars(requests)", []string{
+		"DELETE /api/v4/projects/51/pipeline_schedules/4/variables/OLD",
+		"POST /api/v4/projects/51/pipeline_schedules/4/variables",
+		"PUT /api/v4/projects/51/pipeline_schedules/4/variables/MODE",
+	})
+}
+
+func TestGLCliScheduleVarValues(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "schedules.json")
+	err := os.WriteFile(filename, []byte(`[{"description": "Nightly", "ref": "main", "cron": "0 2 * * *", "active": true,
+		"variables": [{"key": "TOKEN", "value_ref": "env:GLCLI_TEST_SCHEDULE_TOKEN"}]}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GLCLI_TEST_SCHEDULE_TOKEN", "from-env")
+	schedule := `{"id": 4, "description": "Nightly", "ref": "refs/tags/v1.0", "cron": "0 2 * * *", "cron_timezone": "UTC", "active": true,
+		"variables": [{"key": "TOKEN", "value": "from-env", "variable_type": "env_var"}, {"key": "PASSWORD", "value": "plain", "variable_type": "env_var"}]}`
+	server, _ := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/pipeline_schedules":   "[" + schedule + "]",
+		"GET /api/v4/projects/51/pipeline_schedules/4": schedule,
+	})
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.Config.KeyFile = writeTestKeyFile(t)
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	glcli.exportSchedules(filename)
+
+	data, err := ImportScheduleFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 || data[0].Ref != "refs/tags/v1.0" || len(data[0].Variables) != 2 {
+		t.Fatalf(`TestGLCliScheduleVarValues(exported schedules) = %v, want Nightly on refs/tags/v1.0 with 2 variables`, data)
+	}
+	password := data[0].Variables[0]
+	if password.Key != "PASSWORD" || !IsEncrypted(password.Value) {
+		t.Errorf(`TestGLCliScheduleVarValues(PASSWORD) = %v, want an encrypted value`, password)
+	}
+	token := data[0].Variables[1]
+	if token.Key != "TOKEN" || token.Value != "" || token.ValueRef != "env:GLCLI_TEST_SCHEDULE_TOKEN" {
+		t.Errorf(`TestGLCliScheduleVarValues(TOKEN) = %v, want the value reference kept`, token)
+	}
+
+	resolved := glcli.resolveScheduleVars(filename, data)
+	want := []ScheduleVar{{Key: "PASSWORD", Value: "plain", VariableType: varTypeEnv}, {Key: "TOKEN", Value: "from-env", VariableType: varTypeEnv}}
+	if !slices.Equal(resolved[0].Variables, want) {
+		t.Errorf(`TestGLCliScheduleVarValues(resolved variables) = %v, want %v`, resolved[0].Variables, want)
+	}
+}
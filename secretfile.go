@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Kinds of secrets written in the secrets file.
+const (
+	secretTrigger     = "trigger"
+	secretDeployToken = "deploy_token"
+)
+
+// Secret is a token created by glcli, written in the secrets file as Gitlab
+// only gives its value on creation.
+type Secret struct {
+	Kind      string    `json:"kind"`
+	ProjectId string    `json:"project_id,omitempty"`
+	GroupId   string    `json:"group_id,omitempty"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username,omitempty"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CheckSecretFile checks that a file which contains a token or keys is owned
+// by the current user and not accessible by group and others.
+func CheckSecretFile(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	uid, found := fileOwner(info)
+	if found && uid != os.Getuid() {
+		return fmt.Errorf("%s is owned by user %d, not by current user (fix with: chown %d %s)", filename, uid, os.Getuid(), filename)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s has %s permissions, group and others can access it (fix with: chmod 600 %s)", filename, info.Mode().Perm(), filename)
+	}
+	return nil
+}
+
+// checkSecretFile refuses to use an insecure secret file unless insecure
+// files are allowed.
+func (glcli *GLCli) checkSecretFile(filename string) {
+	err := CheckSecretFile(filename)
+	if err == nil {
+		return
+	}
+	if glcli.Config.AllowInsecureFiles {
+		log.Printf("Use insecure file: %s", err)
+		return
+	}
+	log.Fatalf("Refuse to use insecure file: %s. Use -allow-insecure-token-file option to use it anyway", err)
+}
+
+// AppendSecrets adds secrets to the secrets file, which is only readable by
+// its owner.
+func AppendSecrets(filename string, secrets []Secret) error {
+	var data []Secret
+	content, err := os.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(content, &data)
+		if err != nil {
+			return fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = writeJSONFile(filename, append(data, secrets...), 0600)
+	if err != nil {
+		return err
+	}
+	// An existing file keeps its mode on write
+	return os.Chmod(filename, 0600)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSecretFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "gitlab.token")
+	err := os.WriteFile(filename, []byte("glpat-token\n"), 0600)
+	if err != nil {
+		t.Fatalf(`TestCheckSecretFile(write token file) = %s`, err)
+	}
+	err = CheckSecretFile(filename)
+	if err != nil {
+		t.Errorf(`TestCheckSecretFile(mode 600) = %s, want nil`, err)
+	}
+	err = os.Chmod(filename, 0644)
+	if err != nil {
+		t.Fatalf(`TestCheckSecretFile(chmod) = %s`, err)
+	}
+	err = CheckSecretFile(filename)
+	if err == nil {
+		t.Errorf(`TestCheckSecretFile(mode 644) = nil, want an error`)
+	}
+}
+
+func TestAppendSecrets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "secrets.json")
+	err := os.WriteFile(filename, []byte(`[]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"glptt-first", "glptt-second"} {
+		err = AppendSecrets(filename, []Secret{{Kind: secretTrigger, ProjectId: "51", Name: "deploy", Token: token}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf(`TestAppendSecrets(mode) = %o, want %o`, info.Mode().Perm(), 0600)
+	}
+	var data []Secret
+	content, err := os.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(content, &data)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[1].Token != "glptt-second" {
+		t.Errorf(`TestAppendSecrets(secrets) = %v, want both tokens`, data)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProjectSelection selects projects of the project file by path, visibility
+// and group. The pattern is a glob on path_with_namespace, or a regular
+// expression when it starts with re:.
+type ProjectSelection struct {
+	Pattern    string
+	Visibility string
+	GroupId    string
+}
+
+// IsEmpty tells if no criteria is given.
+func (selection ProjectSelection) IsEmpty() bool {
+	return selection.Pattern == "" && selection.Visibility == "" && selection.GroupId == ""
+}
+
+// Matcher returns the function which tells if a project is selected.
+func (selection ProjectSelection) Matcher() (func(project CachedProject) bool, error) {
+	matchPath, err := pathMatcher(selection.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(project CachedProject) bool {
+		if selection.Visibility != "" && project.Visibility != selection.Visibility {
+			return false
+		}
+		if selection.GroupId != "" && strconv.Itoa(project.Namespace.Id) != selection.GroupId {
+			return false
+		}
+		return matchPath(project.PathWithNamespace)
+	}, nil
+}
+
+// pathMatcher returns the function which tells if a path matches a glob
+// pattern, or a regular expression with the re: prefix. Any path matches an
+// empty pattern.
+func pathMatcher(pattern string) (func(name string) bool, error) {
+	if expr, found := strings.CutPrefix(pattern, "re:"); found {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %w", expr, err)
+		}
+		return regex.MatchString, nil
+	}
+	if pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// Select returns the projects of the cache which match the selection, sorted
+// by path.
+func (cache *ProjectCache) Select(selection ProjectSelection) ([]CachedProject, error) {
+	match, err := selection.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	var projects []CachedProject
+	for key, project := range cache.projects {
+		// Projects are cached by id and by path, keep them once
+		if key == project.PathWithNamespace && match(project) {
+			projects = append(projects, project)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].PathWithNamespace < projects[j].PathWithNamespace
+	})
+	return projects, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProjectSelection(t *testing.T) {
+	cache := ProjectCache{projects: make(map[string]CachedProject)}
+	for idx, name := range []string{"sources/api", "sources/web", "sources/tools/cli", "docs/site"} {
+		var project CachedProject
+		project.Id = idx + 1
+		project.PathWithNamespace = name
+		project.Visibility = "private"
+		project.Namespace.Id = 10
+		if name == "sources/web" {
+			project.Visibility = "public"
+			project.Namespace.Id = 11
+		}
+		cache.add(project)
+	}
+	tests := []struct {
+		name      string
+		selection ProjectSelection
+		want      []string
+	}{
+		{"glob", ProjectSelection{Pattern: "sources/*"}, []string{"sources/api", "sources/web"}},
+		{"regex", ProjectSelection{Pattern: "re:^sources/"}, []string{"sources/api", "sources/tools/cli", "sources/web"}},
+		{"visibility", ProjectSelection{Pattern: "sources/*", Visibility: "private"}, []string{"sources/api"}},
+		{"group", ProjectSelection{GroupId: "11"}, []string{"sources/web"}},
+	}
+	for _, test := range tests {
+		projects, err := cache.Select(test.selection)
+		if err != nil {
+			t.Fatalf(`TestProjectSelection(%s) = %s`, test.name, err)
+		}
+		var paths []string
+		for _, project := range projects {
+			paths = append(paths, project.PathWithNamespace)
+		}
+		if len(paths) != len(test.want) {
+			t.Errorf(`TestProjectSelection(%s) = %v, want %v`, test.name, paths, test.want)
+			continue
+		}
+		for idx := range paths {
+			if paths[idx] != test.want[idx] {
+				t.Errorf(`TestProjectSelection(%s) = %v, want %v`, test.name, paths, test.want)
+				break
+			}
+		}
+	}
+	_, err := cache.Select(ProjectSelection{Pattern: "re:("})
+	if err == nil {
+		t.Errorf(`TestProjectSelection(invalid regex) = nil, want an error`)
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// SOPS files are JSON or YAML documents with a sops metadata key. As SOPS
+// files must be mappings, vars are stored under the variables key.
+const (
+	sopsMetadataKey = "sops"
+	sopsVarsKey     = "variables"
+	sopsVersion     = "3.9.0"
+	sopsValueRegex  = "^value$"
+)
+
+var sopsEncryptedRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// sopsItem is a key of a SOPS tree. Keys are kept in document order because
+// the SOPS MAC depends on the order of values.
+type sopsItem struct {
+	Key   string
+	Value any
+}
+
+type sopsBranch []sopsItem
+
+func (branch sopsBranch) Get(key string) (any, bool) {
+	for _, item := range branch {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (branch sopsBranch) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for idx, item := range branch {
+		if idx > 0 {
+			buffer.WriteByte(',')
+		}
+		key, err := json.Marshal(item.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+type sopsAgeKey struct {
+	Recipient string `json:"recipient" yaml:"recipient"`
+	Enc       string `json:"enc" yaml:"enc"`
+}
+
+type sopsMetadata struct {
+	Age               []sopsAgeKey `json:"age"`
+	LastModified      string       `json:"lastmodified"`
+	Mac               string       `json:"mac"`
+	UnencryptedSuffix string       `json:"unencrypted_suffix,omitempty"`
+	EncryptedSuffix   string       `json:"encrypted_suffix,omitempty"`
+	UnencryptedRegex  string       `json:"unencrypted_regex,omitempty"`
+	EncryptedRegex    string       `json:"encrypted_regex,omitempty"`
+	MACOnlyEncrypted  bool         `json:"mac_only_encrypted,omitempty"`
+	Version           string       `json:"version"`
+}
+
+// parseSopsTree parses a JSON or YAML document in a tree which keeps the order
+// of keys.
+func parseSopsTree(content []byte, format string) (any, error) {
+	if format == formatYAML {
+		var node yaml.Node
+		err := yaml.Unmarshal(content, &node)
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 0 {
+			return nil, errors.New("empty document")
+		}
+		return yamlNodeToTree(node.Content[0])
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	return jsonToTree(decoder)
+}
+
+func jsonToTree(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			branch := sopsBranch{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				child, err := jsonToTree(decoder)
+				if err != nil {
+					return nil, err
+				}
+				branch = append(branch, sopsItem{Key: key.(string), Value: child})
+			}
+			_, err = decoder.Token()
+			return branch, err
+		case '[':
+			list := []any{}
+			for decoder.More() {
+				child, err := jsonToTree(decoder)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, child)
+			}
+			_, err = decoder.Token()
+			return list, err
+		}
+	case json.Number:
+		integer, err := strconv.Atoi(value.String())
+		if err == nil {
+			return integer, nil
+		}
+		return value.Float64()
+	}
+	return token, nil
+}
+
+func yamlNodeToTree(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		branch := sopsBranch{}
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			child, err := yamlNodeToTree(node.Content[idx+1])
+			if err != nil {
+				return nil, err
+			}
+			branch = append(branch, sopsItem{Key: node.Content[idx].Value, Value: child})
+		}
+		return branch, nil
+	case yaml.SequenceNode:
+		list := []any{}
+		for _, item := range node.Content {
+			child, err := yamlNodeToTree(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, child)
+		}
+		return list, nil
+	case yaml.ScalarNode:
+		var value any
+		err := node.Decode(&value)
+		return value, err
+	case yaml.AliasNode:
+		return yamlNodeToTree(node.Alias)
+	}
+	return nil, fmt.Errorf("unsupported YAML node at line %d", node.Line)
+}
+
+// IsSopsTree tells if a parsed document is a SOPS-encrypted document.
+func IsSopsTree(tree any) bool {
+	branch, ok := tree.(sopsBranch)
+	if !ok {
+		return false
+	}
+	_, found := branch.Get(sopsMetadataKey)
+	return found
+}
+
+func sopsGetMetadata(branch sopsBranch) (sopsMetadata, error) {
+	var metadata sopsMetadata
+	value, _ := branch.Get(sopsMetadataKey)
+	content, err := json.Marshal(value)
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(content, &metadata)
+	return metadata, err
+}
+
+// sopsIsEncrypted applies the SOPS rules which tell if the value at path is
+// encrypted.
+func sopsIsEncrypted(metadata sopsMetadata, path []string) (bool, error) {
+	switch {
+	case metadata.UnencryptedSuffix != "":
+		for _, key := range path {
+			if strings.HasSuffix(key, metadata.UnencryptedSuffix) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case metadata.EncryptedSuffix != "":
+		for _, key := range path {
+			if strings.HasSuffix(key, metadata.EncryptedSuffix) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case metadata.UnencryptedRegex != "":
+		regex, err := regexp.Compile(metadata.UnencryptedRegex)
+		if err != nil {
+			return false, err
+		}
+		for _, key := range path {
+			if regex.MatchString(key) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case metadata.EncryptedRegex != "":
+		regex, err := regexp.Compile(metadata.EncryptedRegex)
+		if err != nil {
+			return false, err
+		}
+		for _, key := range path {
+			if regex.MatchString(key) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// sopsToBytes returns the bytes of a value used to compute the MAC.
+func sopsToBytes(value any) []byte {
+	switch typed := value.(type) {
+	case string:
+		return []byte(typed)
+	case int:
+		return []byte(strconv.Itoa(typed))
+	case float64:
+		return []byte(strconv.FormatFloat(typed, 'f', -1, 64))
+	case bool:
+		if typed {
+			return []byte("True")
+		}
+		return []byte("False")
+	}
+	return nil
+}
+
+// sopsWalk calls leaf on each leaf value of the tree in document order and
+// replaces it by the returned value. Keys of the path are the keys of the
+// mappings which contain the leaf.
+func sopsWalk(tree any, path []string, leaf func(value any, path []string) (any, error)) (any, error) {
+	switch typed := tree.(type) {
+	case sopsBranch:
+		branch := make(sopsBranch, 0, len(typed))
+		for _, item := range typed {
+			child, err := sopsWalk(item.Value, append(append([]string{}, path...), item.Key), leaf)
+			if err != nil {
+				return nil, err
+			}
+			branch = append(branch, sopsItem{Key: item.Key, Value: child})
+		}
+		return branch, nil
+	case []any:
+		list := make([]any, 0, len(typed))
+		for _, item := range typed {
+			child, err := sopsWalk(item, path, leaf)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, child)
+		}
+		return list, nil
+	case nil:
+		return nil, nil
+	}
+	return leaf(tree, path)
+}
+
+func sopsEncryptValue(value any, key []byte, additionalData string) (string, error) {
+	var plain []byte
+	var valueType string
+	switch typed := value.(type) {
+	case string:
+		if typed == "" {
+			return "", nil
+		}
+		valueType = "str"
+		plain = []byte(typed)
+	case int:
+		valueType = "int"
+		plain = []byte(strconv.Itoa(typed))
+	case float64:
+		valueType = "float"
+		plain = []byte(strconv.FormatFloat(typed, 'f', -1, 64))
+	case bool:
+		valueType = "bool"
+		plain = []byte(strconv.FormatBool(typed))
+	default:
+		return "", fmt.Errorf("cannot encrypt value of type %T", value)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, 32)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, 32)
+	_, err = rand.Read(iv)
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plain, []byte(additionalData))
+	data := sealed[:len(sealed)-gcm.Overhead()]
+	tag := sealed[len(sealed)-gcm.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(tag),
+		valueType), nil
+}
+
+func sopsDecryptValue(value string, key []byte, additionalData string) (any, error) {
+	if value == "" {
+		return "", nil
+	}
+	matches := sopsEncryptedRegexp.FindStringSubmatch(value)
+	if matches == nil {
+		return nil, errors.New("value is not a SOPS encrypted value")
+	}
+	var parts [3][]byte
+	for idx := range parts {
+		decoded, err := base64.StdEncoding.DecodeString(matches[idx+1])
+		if err != nil {
+			return nil, err
+		}
+		parts[idx] = decoded
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, parts[1], append(parts[0], parts[2]...), []byte(additionalData))
+	if err != nil {
+		return nil, err
+	}
+	switch matches[4] {
+	case "str", "bytes", "comment":
+		return string(plain), nil
+	case "int":
+		return strconv.Atoi(string(plain))
+	case "float":
+		return strconv.ParseFloat(string(plain), 64)
+	case "bool":
+		return strconv.ParseBool(string(plain))
+	}
+	return nil, fmt.Errorf("unknown SOPS value type %s", matches[4])
+}
+
+// SopsDecrypt decrypts a SOPS tree with age identities, checks its MAC and
+// returns the tree without SOPS metadata.
+func SopsDecrypt(tree any, identities []age.Identity) (sopsBranch, error) {
+	branch, ok := tree.(sopsBranch)
+	if !ok || !IsSopsTree(tree) {
+		return nil, errors.New("document is not SOPS-encrypted")
+	}
+	metadata, err := sopsGetMetadata(branch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOPS metadata: %w", err)
+	}
+	var dataKey []byte
+	for _, item := range metadata.Age {
+		reader, err := age.Decrypt(armor.NewReader(strings.NewReader(item.Enc)), identities...)
+		if err != nil {
+			continue
+		}
+		dataKey, err = io.ReadAll(reader)
+		if err == nil {
+			break
+		}
+	}
+	if dataKey == nil {
+		return nil, errors.New("cannot decrypt SOPS data key with the age identities of the key file")
+	}
+
+	var data sopsBranch
+	for _, item := range branch {
+		if item.Key != sopsMetadataKey {
+			data = append(data, item)
+		}
+	}
+	hash := sha512.New()
+	decrypted, err := sopsWalk(data, nil, func(value any, path []string) (any, error) {
+		encrypted, err := sopsIsEncrypted(metadata, path)
+		if err != nil {
+			return nil, err
+		}
+		if encrypted {
+			text, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("value of %s is not encrypted", strings.Join(path, ":"))
+			}
+			value, err = sopsDecryptValue(text, dataKey, strings.Join(path, ":")+":")
+			if err != nil {
+				return nil, fmt.Errorf("cannot decrypt value of %s: %w", strings.Join(path, ":"), err)
+			}
+		}
+		if encrypted || !metadata.MACOnlyEncrypted {
+			hash.Write(sopsToBytes(value))
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	mac, err := sopsDecryptValue(metadata.Mac, dataKey, metadata.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt SOPS MAC: %w", err)
+	}
+	if mac != fmt.Sprintf("%X", hash.Sum(nil)) {
+		return nil, errors.New("SOPS MAC mismatch, file has been modified without sops")
+	}
+	return decrypted.(sopsBranch), nil
+}
+
+// SopsEncrypt encrypts the values of a tree for age recipients. Only the values
+// of value keys are encrypted, so other var attributes stay readable.
+func SopsEncrypt(data sopsBranch, recipients []string, now time.Time) (sopsBranch, error) {
+	metadata := sopsMetadata{
+		EncryptedRegex: sopsValueRegex,
+		LastModified:   now.UTC().Format(time.RFC3339),
+		Version:        sopsVersion,
+	}
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, recipient := range recipients {
+		parsed, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		var buffer bytes.Buffer
+		armored := armor.NewWriter(&buffer)
+		writer, err := age.Encrypt(armored, parsed)
+		if err != nil {
+			return nil, err
+		}
+		_, err = writer.Write(dataKey)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err == nil {
+			err = armored.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		metadata.Age = append(metadata.Age, sopsAgeKey{Recipient: recipient, Enc: buffer.String() + "\n"})
+	}
+
+	hash := sha512.New()
+	encrypted, err := sopsWalk(data, nil, func(value any, path []string) (any, error) {
+		hash.Write(sopsToBytes(value))
+		encrypted, err := sopsIsEncrypted(metadata, path)
+		if err != nil || !encrypted {
+			return value, err
+		}
+		return sopsEncryptValue(value, dataKey, strings.Join(path, ":")+":")
+	})
+	if err != nil {
+		return nil, err
+	}
+	metadata.Mac, err = sopsEncryptValue(fmt.Sprintf("%X", hash.Sum(nil)), dataKey, metadata.LastModified)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	var metadataTree any
+	metadataTree, err = jsonToTree(json.NewDecoder(bytes.NewReader(content)))
+	if err != nil {
+		return nil, err
+	}
+	return append(encrypted.(sopsBranch), sopsItem{Key: sopsMetadataKey, Value: metadataTree}), nil
+}
+
+// sopsRecipients returns the age recipients of a SOPS tree.
+func sopsRecipients(tree any) []string {
+	var recipients []string
+	branch, ok := tree.(sopsBranch)
+	if !ok {
+		return recipients
+	}
+	metadata, err := sopsGetMetadata(branch)
+	if err != nil {
+		return recipients
+	}
+	for _, item := range metadata.Age {
+		recipients = append(recipients, item.Recipient)
+	}
+	return recipients
+}
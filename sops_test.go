@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSopsReadWrite(t *testing.T) {
+	var glcli GLCli
+	glcli.Config.KeyFile = writeTestKeyFile(t)
+	var item VarFileData
+	item.Key = "TOKEN"
+	item.Value = "s3cr3t"
+	item.Env = "*"
+	item.IsMasked = true
+	for _, name := range []string{"vars.json", "vars.yaml"} {
+		varfile := filepath.Join(t.TempDir(), name)
+		err := glcli.writeVarFile(varfile, []VarFileData{item}, []string{})
+		if err != nil {
+			t.Fatalf(`TestSopsReadWrite(write plain %s) = %s`, name, err)
+		}
+		err = glcli.writeVarFile(varfile, []VarFileData{item}, glcli.getCipher().Recipients()[1:])
+		if err != nil {
+			t.Fatalf(`TestSopsReadWrite(write %s) = %s`, name, err)
+		}
+		content, err := os.ReadFile(varfile)
+		if err != nil {
+			t.Fatalf(`TestSopsReadWrite(read %s) = %s`, name, err)
+		}
+		if strings.Contains(string(content), "s3cr3t") {
+			t.Errorf(`TestSopsReadWrite(plain value in %s) = found, want not found`, name)
+		}
+		_, err = ImportVarFile(varfile)
+		if err == nil {
+			t.Errorf(`TestSopsReadWrite(import %s without decryption) = nil, want an error`, name)
+		}
+		data, recipients, err := glcli.readVarFile(varfile)
+		if err != nil {
+			t.Fatalf(`TestSopsReadWrite(decrypt %s) = %s`, name, err)
+		}
+		if len(recipients) != 2 {
+			t.Errorf(`TestSopsReadWrite(count recipients of %s) = %d, want %d`, name, len(recipients), 2)
+		}
+		if len(data) != 1 || data[0].Value != "s3cr3t" || !data[0].IsMasked {
+			t.Errorf(`TestSopsReadWrite(vars of %s) = %v, want %v`, name, data, []VarFileData{item})
+		}
+	}
+}
+
+func TestSopsTamperedFile(t *testing.T) {
+	var glcli GLCli
+	glcli.Config.KeyFile = writeTestKeyFile(t)
+	var item VarFileData
+	item.Key = "TOKEN"
+	item.Value = "s3cr3t"
+	item.Env = "*"
+	varfile := filepath.Join(t.TempDir(), "vars.json")
+	err := glcli.writeVarFile(varfile, []VarFileData{item}, glcli.getCipher().Recipients())
+	if err != nil {
+		t.Fatalf(`TestSopsTamperedFile(write) = %s`, err)
+	}
+	content, err := os.ReadFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestSopsTamperedFile(read) = %s`, err)
+	}
+	content = []byte(strings.Replace(string(content), `"key": "TOKEN"`, `"key": "OTHER"`, 1))
+	err = os.WriteFile(varfile, content, 0644)
+	if err != nil {
+		t.Fatalf(`TestSopsTamperedFile(write tampered file) = %s`, err)
+	}
+	_, _, err = glcli.readVarFile(varfile)
+	if err == nil {
+		t.Errorf(`TestSopsTamperedFile(decrypt) = nil, want an error`)
+	}
+}
+
+// The fixtures of testdata were encrypted by the sops binary for the age key
+// of testdata/sops-age.key, with sops encrypt --encrypted-regex '^value$'.
+func TestSopsFixtures(t *testing.T) {
+	var glcli GLCli
+	glcli.Config.KeyFile = filepath.Join("testdata", "sops-age.key")
+	// Git does not keep the mode of the test key.
+	glcli.Config.AllowInsecureFiles = true
+	want := map[string]string{
+		"TOKEN@*":         "s3cr3t",
+		"CERT@production": "-----BEGIN-----\nabc\n",
+	}
+	for _, name := range []string{"sops-vars.json", "sops-vars.yaml"} {
+		data, recipients, err := glcli.readVarFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf(`TestSopsFixtures(decrypt %s) = %s`, name, err)
+		}
+		if len(recipients) != 1 {
+			t.Errorf(`TestSopsFixtures(count recipients of %s) = %d, want %d`, name, len(recipients), 1)
+		}
+		if len(data) != len(want) {
+			t.Fatalf(`TestSopsFixtures(count vars of %s) = %d, want %d`, name, len(data), len(want))
+		}
+		for _, item := range data {
+			if item.Value != want[varId(item.Key, item.Env)] {
+				t.Errorf(`TestSopsFixtures(value of %s in %s) = %q, want %q`, varId(item.Key, item.Env), name, item.Value, want[varId(item.Key, item.Env)])
+			}
+		}
+		if data[1].VariableType != varTypeFile || !data[0].IsMasked {
+			t.Errorf(`TestSopsFixtures(attributes of %s) = %v, want file type and masked token`, name, data)
+		}
+
+		varfile := filepath.Join(t.TempDir(), name)
+		err = glcli.writeVarFile(varfile, data, recipients)
+		if err != nil {
+			t.Fatalf(`TestSopsFixtures(re-encrypt %s) = %s`, name, err)
+		}
+		content, err := os.ReadFile(varfile)
+		if err != nil {
+			t.Fatalf(`TestSopsFixtures(read %s) = %s`, name, err)
+		}
+		if strings.Contains(string(content), "s3cr3t") {
+			t.Errorf(`TestSopsFixtures(plain value in re-encrypted %s) = found, want not found`, name)
+		}
+		again, _, err := glcli.readVarFile(varfile)
+		if err != nil {
+			t.Fatalf(`TestSopsFixtures(decrypt re-encrypted %s) = %s`, name, err)
+		}
+		if len(again) != len(data) {
+			t.Fatalf(`TestSopsFixtures(count re-encrypted vars of %s) = %d, want %d`, name, len(again), len(data))
+		}
+		for _, item := range again {
+			if item.Value != want[varId(item.Key, item.Env)] {
+				t.Errorf(`TestSopsFixtures(re-encrypted value of %s in %s) = %q, want %q`, varId(item.Key, item.Env), name, item.Value, want[varId(item.Key, item.Env)])
+			}
+		}
+	}
+}
+
+// A SOPS file decrypted by the sops binary keeps the variables key.
+func TestSopsDecryptedFile(t *testing.T) {
+	varfile := filepath.Join(t.TempDir(), "vars.json")
+	err := os.WriteFile(varfile, []byte(`{"variables": [{"key": "TOKEN", "value": "s3cr3t", "environment_scope": "*", "variable_type": "env_var"}]}`), 0644)
+	if err != nil {
+		t.Fatalf(`TestSopsDecryptedFile(write) = %s`, err)
+	}
+	data, err := ImportVarFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestSopsDecryptedFile(import) = %s`, err)
+	}
+	if len(data) != 1 || data[0].Value != "s3cr3t" {
+		t.Errorf(`TestSopsDecryptedFile(vars) = %v, want TOKEN var`, data)
+	}
+}
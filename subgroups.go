@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Subgroup is a descendant group of a group.
+type Subgroup struct {
+	Id       int    `json:"id"`
+	FullPath string `json:"full_path"`
+}
+
+// FilterSubgroups returns the subgroups whose full path matches the include
+// pattern and does not match the exclude pattern, sorted by full path. Patterns
+// are globs, or regular expressions with the re: prefix. An empty include
+// pattern includes all subgroups and an empty exclude pattern excludes none.
+func FilterSubgroups(groups []Subgroup, include string, exclude string) ([]Subgroup, error) {
+	included, err := pathMatcher(include)
+	if err != nil {
+		return nil, err
+	}
+	excluded := func(string) bool { return false }
+	if exclude != "" {
+		excluded, err = pathMatcher(exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var kept []Subgroup
+	for _, group := range groups {
+		if included(group.FullPath) && !excluded(group.FullPath) {
+			kept = append(kept, group)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].FullPath < kept[j].FullPath
+	})
+	return kept, nil
+}
+
+// RecursiveGroupRun applies the group var file to every subgroup of the group,
+// at any depth, then shows a summary of the changes of each subgroup. The
+// group itself is not changed.
+func (glcli *GLCli) RecursiveGroupRun() {
+	if glcli.Config.ExportMode {
+		log.Fatal("Export is not available in recursive mode because subgroups share the group var file")
+	}
+	_, err := os.Stat(glcli.Config.GroupVarsFile)
+	if err != nil {
+		log.Fatal("Nothing to do because group var file cannot be found. You may create it with the export flag in command line.")
+	}
+	var groups []Subgroup
+	err = glcli.client.GetAll("groups/"+url.PathEscape(glcli.GroupId)+"/descendant_groups", &groups)
+	if err != nil {
+		log.Fatalf("Cannot fetch subgroups of group %s: %s", glcli.GroupId, err)
+	}
+	subgroups, err := FilterSubgroups(groups, glcli.Config.IncludeGroups, glcli.Config.ExcludeGroups)
+	if err != nil {
+		log.Fatalf("Cannot filter subgroups: %s", err)
+	}
+	log.Printf("%d subgroup(s) of %d selected", len(subgroups), len(groups))
+
+	summaries := make([]SyncSummary, 0, len(subgroups))
+	for _, group := range subgroups {
+		member := *glcli
+		member.GroupId = strconv.Itoa(group.Id)
+		// Subgroups inherit the labels of the group
+		member.Config.LabelsFile = ""
+		member.initClients()
+		log.Printf("Sync subgroup %s (id %d)", group.FullPath, group.Id)
+		member.syncGroup()
+		summaries = append(summaries, member.summary)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "GROUP\tGROUP VARS")
+	var total ChangeCount
+	for idx, summary := range summaries {
+		fmt.Fprintf(writer, "%s\t%s\n", subgroups[idx].FullPath, summary.GroupVars)
+		total.add(summary.GroupVars)
+	}
+	fmt.Fprintf(writer, "%s\t%s\n", "TOTAL", total)
+	err = writer.Flush()
+	if err != nil {
+		log.Fatalf("Cannot write summary: %s", err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFilterSubgroups(t *testing.T) {
+	groups := []Subgroup{
+		{Id: 3, FullPath: "infra/prod"},
+		{Id: 2, FullPath: "infra/dev"},
+		{Id: 4, FullPath: "infra/prod/eu"},
+		{Id: 5, FullPath: "infra/sandbox"},
+	}
+	subgroups, err := FilterSubgroups(groups, "", "")
+	if err != nil || len(subgroups) != 4 || subgroups[0].FullPath != "infra/dev" {
+		t.Errorf(`TestFilterSubgroups(all) = %v, %v, want 4 subgroups sorted by path`, subgroups, err)
+	}
+	subgroups, _ = FilterSubgroups(groups, "infra/*", "infra/sandbox")
+	if len(subgroups) != 2 || subgroups[0].Id != 2 || subgroups[1].Id != 3 {
+		t.Errorf(`TestFilterSubgroups(glob) = %v, want infra/dev and infra/prod`, subgroups)
+	}
+	subgroups, _ = FilterSubgroups(groups, "re:^infra/prod", "")
+	if len(subgroups) != 2 || subgroups[1].FullPath != "infra/prod/eu" {
+		t.Errorf(`TestFilterSubgroups(regex) = %v, want infra/prod and infra/prod/eu`, subgroups)
+	}
+	_, err = FilterSubgroups(groups, "", "re:[")
+	if err == nil {
+		t.Errorf(`TestFilterSubgroups(invalid exclude) = nil, want an error`)
+	}
+}
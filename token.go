@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Gitlab API header which carries tokens.
+const tokenHeaderPrivate = "PRIVATE-TOKEN"
+
+// TokenProvider is a source of Gitlab tokens. Token returns an empty token
+// when the source has no token.
+type TokenProvider struct {
+	Name  string
+	Token func() (string, error)
+}
+
+// tokenProviders returns the token sources in the order they are tried. CI
+// job tokens are not a source: Gitlab does not accept them on the variables,
+// environments and projects API endpoints.
+func (glcli *GLCli) tokenProviders() []TokenProvider {
+	return []TokenProvider{
+		{Name: "GLCLI_TOKEN environment variable", Token: func() (string, error) {
+			return os.Getenv("GLCLI_TOKEN"), nil
+		}},
+		{Name: "token file " + glcli.Config.TokenFile, Token: func() (string, error) {
+			_, err := os.Stat(glcli.Config.TokenFile)
+			if err == nil {
+				glcli.checkSecretFile(glcli.Config.TokenFile)
+			}
+			return readTokenFile(glcli.Config.TokenFile)
+		}},
+		{Name: "token helper " + glcli.Config.TokenHelper, Token: func() (string, error) {
+			return runTokenHelper(glcli.Config.TokenHelper, glcli.Config.GitlabUrl)
+		}},
+		{Name: "keyring", Token: func() (string, error) {
+			return lookupKeyring(glcli.Config.GitlabUrl)
+		}},
+	}
+}
+
+// getToken returns the first token given by the token providers, with the
+// name of its source.
+func (glcli *GLCli) getToken() (string, string, error) {
+	for _, provider := range glcli.tokenProviders() {
+		token, err := provider.Token()
+		if err != nil {
+			if glcli.Config.VerboseMode {
+				log.Printf("Cannot get token from %s: %s", provider.Name, err)
+			}
+			continue
+		}
+		if token != "" {
+			return token, provider.Name, nil
+		}
+	}
+	return "", "", errors.New("no token found in GLCLI_TOKEN environment variable, token file, token helper or keyring")
+}
+
+func readTokenFile(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// runTokenHelper asks a git credential helper for the credentials of the
+// Gitlab host. The helper is called with the get argument and the protocol and
+// host on its standard input, and the token is the returned password.
+func runTokenHelper(helper string, gitlabUrl string) (string, error) {
+	args := strings.Fields(helper)
+	if len(args) == 0 {
+		return "", nil
+	}
+	parsed, err := url.Parse(gitlabUrl)
+	if err != nil {
+		return "", err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(args[0], append(args[1:], "get")...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", parsed.Scheme, parsed.Host))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %w", args[0], err)
+	}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "password=")
+		if found {
+			return value, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// lookupKeyring reads the token of the Gitlab host stored with the service
+// glcli attribute in the Secret Service keyring, through secret-tool.
+func lookupKeyring(gitlabUrl string) (string, error) {
+	_, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return "", nil
+	}
+	parsed, err := url.Parse(gitlabUrl)
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command("secret-tool", "lookup", "service", "glcli", "host", parsed.Host).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// secret-tool exits with 1 when no secret matches
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
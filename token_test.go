@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenProviders(t *testing.T) {
+	dir := t.TempDir()
+	var glcli GLCli
+	glcli.Config.GitlabUrl = "https://gitlab.example.com"
+	glcli.Config.TokenFile = filepath.Join(dir, "gitlab.token")
+	t.Setenv("GLCLI_TOKEN", "")
+	t.Setenv("GITLAB_CI", "")
+	t.Setenv("PATH", dir)
+
+	_, _, err := glcli.getToken()
+	if err == nil {
+		t.Errorf(`TestTokenProviders(no token) = nil, want an error`)
+	}
+
+	helper := filepath.Join(dir, "helper")
+	script := "#!/bin/sh\nread protocol\nread host\n[ \"$1 $host\" = \"get host=gitlab.example.com\" ] && echo username=glcli && echo password=glpat-helper\n"
+	err = os.WriteFile(helper, []byte(script), 0700)
+	if err != nil {
+		t.Fatalf(`TestTokenProviders(write helper) = %s`, err)
+	}
+	glcli.Config.TokenHelper = helper
+	token, _, err := glcli.getToken()
+	if err != nil || token != "glpat-helper" {
+		t.Errorf(`TestTokenProviders(from helper) = %s, %v, want %s`, token, err, "glpat-helper")
+	}
+
+	err = os.WriteFile(glcli.Config.TokenFile, []byte("glpat-file\n"), 0600)
+	if err != nil {
+		t.Fatalf(`TestTokenProviders(write token file) = %s`, err)
+	}
+	token, _, _ = glcli.getToken()
+	if token != "glpat-file" {
+		t.Errorf(`TestTokenProviders(from file) = %s, want %s`, token, "glpat-file")
+	}
+
+	t.Setenv("GLCLI_TOKEN", "glpat-env")
+	token, source, _ := glcli.getToken()
+	if token != "glpat-env" {
+		t.Errorf(`TestTokenProviders(from env) = %s (%s), want %s`, token, source, "glpat-env")
+	}
+}
+
+func TestTokenProvidersJobToken(t *testing.T) {
+	var glcli GLCli
+	glcli.Config.GitlabUrl = "https://gitlab.example.com"
+	glcli.Config.TokenFile = filepath.Join(t.TempDir(), "missing")
+	t.Setenv("GLCLI_TOKEN", "")
+	t.Setenv("PATH", "")
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_JOB_TOKEN", "job-token")
+	token, source, err := glcli.getToken()
+	if err == nil {
+		t.Errorf(`TestTokenProvidersJobToken(token) = %s from %s, want an error`, token, source)
+	}
+}
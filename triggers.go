@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// TriggerData is a pipeline trigger token of trigger file. Triggers are
+// matched by description and their token is never written in this file.
+type TriggerData struct {
+	Description string `json:"description"`
+}
+
+// GitlabTrigger is a pipeline trigger token as returned by Gitlab API. The
+// token is only given in full to its owner.
+type GitlabTrigger struct {
+	Id          int        `json:"id"`
+	Description string     `json:"description"`
+	Token       string     `json:"token"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsed    *time.Time `json:"last_used"`
+	Owner       *struct {
+		Username string `json:"username"`
+	} `json:"owner"`
+}
+
+// ImportTriggerFile reads a trigger file and checks that descriptions are
+// given and unique.
+func ImportTriggerFile(filename string) ([]TriggerData, error) {
+	var data []TriggerData
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	seen := make(map[string]bool)
+	for idx, item := range data {
+		if item.Description == "" {
+			return nil, fmt.Errorf("trigger %d of %s has no description", idx+1, filename)
+		}
+		if seen[item.Description] {
+			return nil, fmt.Errorf("trigger %s is defined twice in %s", item.Description, filename)
+		}
+		seen[item.Description] = true
+	}
+	return data, nil
+}
+
+// ExportTriggerFile writes triggers to filename, sorted by description.
+func ExportTriggerFile(filename string, data []TriggerData) error {
+	sorted := make([]TriggerData, len(data))
+	copy(sorted, data)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Description < sorted[j].Description
+	})
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// CompareTriggers returns the triggers of trigger file missing on Gitlab and
+// the Gitlab triggers missing in the file. Gitlab triggers sharing a
+// description cannot be matched and give an error.
+func CompareTriggers(data []TriggerData, gitlab []GitlabTrigger) ([]TriggerData, []GitlabTrigger, error) {
+	var toAdd []TriggerData
+	var toDelete []GitlabTrigger
+	current := make(map[string]bool)
+	for _, item := range gitlab {
+		if current[item.Description] {
+			return nil, nil, fmt.Errorf("several Gitlab triggers are described as %s", item.Description)
+		}
+		current[item.Description] = true
+	}
+	wanted := make(map[string]bool)
+	for _, item := range data {
+		wanted[item.Description] = true
+		if !current[item.Description] {
+			toAdd = append(toAdd, item)
+		}
+	}
+	for _, item := range gitlab {
+		if !wanted[item.Description] {
+			toDelete = append(toDelete, item)
+		}
+	}
+	return toAdd, toDelete, nil
+}
+
+func triggersPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/triggers"
+}
+
+// getTriggers returns the pipeline trigger tokens of the project.
+func (glcli *GLCli) getTriggers() []GitlabTrigger {
+	var data []GitlabTrigger
+	err := glcli.client.GetAll(triggersPath(glcli.ProjectId), &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch pipeline triggers from gitlab: %s", err)
+	}
+	return data
+}
+
+// exportTriggers writes the trigger descriptions of the project in filename.
+// The file is only written when the project has triggers or when it exists.
+func (glcli *GLCli) exportTriggers(filename string) {
+	triggers := glcli.getTriggers()
+	if len(triggers) == 0 {
+		_, err := os.Stat(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			if glcli.Config.VerboseMode {
+				log.Printf("No pipeline trigger to export in %s file", filename)
+			}
+			return
+		}
+	}
+	data := make([]TriggerData, 0, len(triggers))
+	for _, item := range triggers {
+		data = append(data, TriggerData{Description: item.Description})
+	}
+	err := ExportTriggerFile(filename, data)
+	if err != nil {
+		log.Fatalf("Cannot export pipeline triggers to %s: %s", filename, err)
+	}
+}
+
+// syncTriggers creates the triggers of trigger file missing on Gitlab and
+// writes their token in the secrets file. Triggers missing in the file are
+// only deleted in delete mode.
+func (glcli *GLCli) syncTriggers(filename string) {
+	data, err := ImportTriggerFile(filename)
+	if err != nil {
+		log.Fatalf("Cannot import trigger file: %s", err)
+	}
+	toAdd, toDelete, err := CompareTriggers(data, glcli.getTriggers())
+	if err != nil {
+		log.Fatalf("Cannot compare pipeline triggers: %s", err)
+	}
+	glcli.summary.Triggers.count(len(toAdd), 0, len(toDelete), glcli.Config.DeleteMode)
+	created := 0
+	for _, item := range toAdd {
+		log.Printf("Pipeline trigger %s should be created", item.Description)
+		if glcli.Config.DryrunMode {
+			continue
+		}
+		var trigger GitlabTrigger
+		err = glcli.client.Request(http.MethodPost, triggersPath(glcli.ProjectId), map[string]string{"description": item.Description}, &trigger)
+		if err != nil {
+			log.Fatalf("Cannot create pipeline trigger %s: %s", item.Description, err)
+		}
+		// Each token is written as soon as it exists, to not lose it if a
+		// next creation fails
+		secret := Secret{Kind: secretTrigger, ProjectId: glcli.ProjectId, Name: trigger.Description, Token: trigger.Token, CreatedAt: trigger.CreatedAt}
+		err = AppendSecrets(glcli.Config.SecretsFile, []Secret{secret})
+		if err != nil {
+			log.Fatalf("Cannot write token of pipeline trigger %s to %s: %s", item.Description, glcli.Config.SecretsFile, err)
+		}
+		created++
+	}
+	if created > 0 {
+		log.Printf("%d pipeline trigger token(s) written to %s file", created, glcli.Config.SecretsFile)
+	}
+	if len(toAdd) == 0 {
+		log.Print("No pipeline trigger to insert")
+	}
+	if len(toDelete) == 0 {
+		log.Print("No pipeline trigger to delete")
+	}
+	if glcli.Config.DeleteMode && !glcli.Config.DryrunMode {
+		for _, item := range toDelete {
+			err = glcli.client.Request(http.MethodDelete, fmt.Sprintf("%s/%d", triggersPath(glcli.ProjectId), item.Id), nil, nil)
+			if err != nil {
+				log.Fatalf("Cannot delete pipeline trigger %s: %s", item.Description, err)
+			}
+			log.Printf("Delete pipeline trigger %s", item.Description)
+		}
+	} else if len(toDelete) > 0 {
+		log.Printf("%d pipeline trigger(s) may be deleted, but delete flag in command line is not set", len(toDelete))
+	}
+}
+
+// ListTriggers shows the pipeline trigger tokens of the project, without
+// their token.
+func (glcli *GLCli) ListTriggers() {
+	triggers := glcli.getTriggers()
+	sort.SliceStable(triggers, func(i, j int) bool {
+		return triggers[i].Description < triggers[j].Description
+	})
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tDESCRIPTION\tOWNER\tCREATED\tLAST USED")
+	for _, item := range triggers {
+		owner := "-"
+		if item.Owner != nil {
+			owner = item.Owner.Username
+		}
+		lastUsed := "never"
+		if item.LastUsed != nil {
+			lastUsed = item.LastUsed.Format(time.DateOnly)
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\n", item.Id, item.Description, owner, item.CreatedAt.Format(time.DateOnly), lastUsed)
+	}
+	err := writer.Flush()
+	if err != nil {
+		log.Fatalf("Cannot write trigger list: %s", err)
+	}
+}
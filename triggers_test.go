@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareTriggers(t *testing.T) {
+	data := []TriggerData{{Description: "deploy from infra"}, {Description: "nightly from ops"}}
+	gitlab := []GitlabTrigger{{Id: 1, Description: "deploy from infra"}, {Id: 2, Description: "legacy"}}
+	toAdd, toDelete, err := CompareTriggers(data, gitlab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toAdd) != 1 || toAdd[0].Description != "nightly from ops" {
+		t.Errorf(`TestCompareTriggers(triggers to add) = %v, want only nightly from ops`, toAdd)
+	}
+	if len(toDelete) != 1 || toDelete[0].Id != 2 {
+		t.Errorf(`TestCompareTriggers(triggers to delete) = %v, want only legacy`, toDelete)
+	}
+	_, _, err = CompareTriggers(data, append(gitlab, GitlabTrigger{Id: 3, Description: "legacy"}))
+	if err == nil {
+		t.Errorf(`TestCompareTriggers(duplicated description) = nil, want error`)
+	}
+}
+
+func TestImportTriggerFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "triggers.json")
+	err := os.WriteFile(filename, []byte(`[{"description": "deploy"}, {"description": "deploy"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ImportTriggerFile(filename)
+	if err == nil {
+		t.Errorf(`TestImportTriggerFile(duplicated description) = nil, want error`)
+	}
+}
+
+func TestGLCliSyncTriggers(t *testing.T) {
+	server, rec := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/triggers":  `[{"id": 1, "description": "deploy from infra"}, {"id": 2, "description": "legacy"}]`,
+		"POST /api/v4/projects/51/triggers": `{"id": 3, "description": "nightly from ops", "token": "glptt-nightly"}`,
+	})
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "triggers.json")
+	err := os.WriteFile(filename, []byte(`[{"description": "deploy from infra"}, {"description": "nightly from ops"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.Config.SecretsFile = filepath.Join(dir, "secrets.json")
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+
+	glcli.Config.DeleteMode = true
+	glcli.Config.DryrunMode = true
+	glcli.syncTriggers(filename)
+	rec.expectWrites(t, "TestGLCliSyncTriggers(dry run requests)", nil)
+
+	glcli.Config.DryrunMode = false
+	glcli.syncTriggers(filename)
+	rec.expectWrites(t, "TestGLCliSyncTriggers(requests)", []string{
+		"POST /api/v4/projects/51/triggers",
+		"DELETE /api/v4/projects/51/triggers/2",
+	})
+	var secrets []Secret
+	content, err := os.ReadFile(glcli.Config.SecretsFile)
+	if err == nil {
+		err = json.Unmarshal(content, &secrets)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 1 || secrets[0].Kind != secretTrigger || secrets[0].Name != "nightly from ops" || secrets[0].Token != "glptt-nightly" {
+		t.Errorf(`TestGLCliSyncTriggers(secrets) = %v, want the token of nightly from ops`, secrets)
+	}
+
+	glcli.Config.DeleteMode = false
+	glcli.syncTriggers(filename)
+	rec.expectWrites(t, "TestGLCliSyncTriggers(requests without delete mode)", []string{"POST /api/v4/projects/51/triggers"})
+}
+
+func TestGLCliExportTriggers(t *testing.T) {
+	server, _ := newRecordingServer(t, map[string]string{
+		"GET /api/v4/projects/51/triggers": `[{"id": 2, "description": "nightly from ops", "token": "glptt-nightly"}, {"id": 1, "description": "deploy from infra", "token": "glptt-deploy"}]`,
+	})
+	filename := filepath.Join(t.TempDir(), "triggers.json")
+	glcli := GLCli{}
+	glcli.ProjectId = "51"
+	glcli.client = NewGitlabClient(server.URL, "token", false)
+	glcli.exportTriggers(filename)
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "glptt-") {
+		t.Errorf(`TestGLCliExportTriggers(content) = %s, want no token`, content)
+	}
+	data, err := ImportTriggerFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[0].Description != "deploy from infra" {
+		t.Errorf(`TestGLCliExportTriggers(triggers) = %v, want both triggers sorted by description`, data)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Value references are written as <source>:<argument> in the value_ref field
+// of var files and are resolved at push time.
+const (
+	refSourceFile = "file"
+	refSourceEnv  = "env"
+	refSourceExec = "exec"
+)
+
+// ValueSource returns the value for the argument of a value reference.
+type ValueSource func(argument string) (string, error)
+
+// ValueResolver resolves value references. Each reference is resolved once
+// per run, so a secret used by several vars is fetched only once.
+type ValueResolver struct {
+	sources map[string]ValueSource
+	cache   map[string]string
+}
+
+// NewValueResolver returns a resolver which knows the file and env sources.
+// The exec source refuses to run commands until AllowExec is called.
+func NewValueResolver() *ValueResolver {
+	resolver := ValueResolver{
+		sources: make(map[string]ValueSource),
+		cache:   make(map[string]string),
+	}
+	resolver.AddSource(refSourceFile, readFileSource)
+	resolver.AddSource(refSourceEnv, readEnvSource)
+	resolver.AddSource(refSourceExec, refuseExecSource)
+	return &resolver
+}
+
+// AllowExec lets exec references run their command.
+func (resolver *ValueResolver) AllowExec() {
+	resolver.AddSource(refSourceExec, runExecSource)
+}
+
+// AddSource registers the source of references which start with name.
+func (resolver *ValueResolver) AddSource(name string, source ValueSource) {
+	resolver.sources[name] = source
+}
+
+// Resolve returns the value of a reference.
+func (resolver *ValueResolver) Resolve(ref string) (string, error) {
+	if value, found := resolver.cache[ref]; found {
+		return value, nil
+	}
+	name, argument, found := strings.Cut(ref, ":")
+	if !found || argument == "" {
+		return "", fmt.Errorf("invalid reference %s (must be <source>:<argument>)", ref)
+	}
+	source, found := resolver.sources[name]
+	if !found {
+		return "", fmt.Errorf("unknown reference source %s", name)
+	}
+	value, err := source(argument)
+	if err != nil {
+		return "", err
+	}
+	resolver.cache[ref] = value
+	return value, nil
+}
+
+// fileRef makes the path of a file reference relative to the directory of
+// filename, like value_from_file paths.
+func fileRef(filename string, ref string) string {
+	name, argument, found := strings.Cut(ref, ":")
+	if !found || name != refSourceFile || argument == "" {
+		return ref
+	}
+	return refSourceFile + ":" + valueFilePath(filename, argument)
+}
+
+func readFileSource(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func readEnvSource(name string) (string, error) {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func refuseExecSource(command string) (string, error) {
+	return "", errors.New("exec references are not allowed, use -allow-exec-refs option to run their command")
+}
+
+// runExecSource runs a command, without shell, and returns its output without
+// the trailing newline. The command can prompt the user, like password
+// managers do to unlock their vault.
+func runExecSource(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("empty command")
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %w", args[0], err)
+	}
+	value := strings.TrimSuffix(stdout.String(), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+// ResolveValueRefs sets the values of vars of the var file filename which have
+// a value_ref. All references are resolved, and each failure is reported,
+// before an error is returned.
+func (resolver *ValueResolver) ResolveValueRefs(filename string, data []VarFileData) ([]VarFileData, error) {
+	resolved := make([]VarFileData, 0, len(data))
+	failures := 0
+	for _, item := range data {
+		if item.ValueRef != "" {
+			var err error
+			if item.Value != "" || item.ValueFromFile != "" {
+				err = errors.New("value_ref cannot be used with value or value_from_file")
+			} else {
+				item.Value, err = resolver.Resolve(fileRef(filename, item.ValueRef))
+			}
+			if err != nil {
+				log.Printf("Cannot resolve value of var %s (%s) from %s: %s", item.Key, item.Env, item.ValueRef, err)
+				failures++
+			}
+		}
+		resolved = append(resolved, item)
+	}
+	if failures > 0 {
+		return nil, fmt.Errorf("%d value reference(s) cannot be resolved", failures)
+	}
+	return resolved, nil
+}
+
+// getResolver creates the value resolver once per run.
+func (glcli *GLCli) getResolver() *ValueResolver {
+	if glcli.resolver == nil {
+		glcli.resolver = NewValueResolver()
+		glcli.resolver.AddSource(refSourceVault, glcli.readVaultSource)
+		if glcli.Config.AllowExecRefs {
+			glcli.resolver.AllowExec()
+		}
+	}
+	return glcli.resolver
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValueRefResolve(t *testing.T) {
+	dir := t.TempDir()
+	secretfile := filepath.Join(dir, "secret")
+	err := os.WriteFile(secretfile, []byte("from-file"), 0600)
+	if err != nil {
+		t.Fatalf(`TestValueRefResolve(write secret file) = %s`, err)
+	}
+	t.Setenv("GLCLI_TEST_SECRET", "from-env")
+	var data []VarFileData
+	for _, ref := range []string{"file:secret", "env:GLCLI_TEST_SECRET", "exec:echo from-exec"} {
+		var item VarFileData
+		item.Key = "SECRET"
+		item.Env = ref
+		item.ValueRef = ref
+		data = append(data, item)
+	}
+	resolver := NewValueResolver()
+	resolver.AllowExec()
+	resolved, err := resolver.ResolveValueRefs(filepath.Join(dir, ".gitlab-vars.json"), data)
+	if err != nil {
+		t.Fatalf(`TestValueRefResolve(resolve) = %s`, err)
+	}
+	for idx, want := range []string{"from-file", "from-env", "from-exec"} {
+		if resolved[idx].Value != want {
+			t.Errorf(`TestValueRefResolve(value of %s) = %q, want %q`, resolved[idx].ValueRef, resolved[idx].Value, want)
+		}
+	}
+
+	err = os.WriteFile(secretfile, []byte("changed"), 0600)
+	if err != nil {
+		t.Fatalf(`TestValueRefResolve(rewrite secret file) = %s`, err)
+	}
+	value, err := resolver.Resolve("file:" + secretfile)
+	if err != nil || value != "from-file" {
+		t.Errorf(`TestValueRefResolve(cached value) = %q, %v, want %q`, value, err, "from-file")
+	}
+}
+
+func TestValueRefFailures(t *testing.T) {
+	var unset, unknown, conflict VarFileData
+	unset.Key = "UNSET"
+	unset.ValueRef = "env:GLCLI_TEST_UNSET_VARIABLE"
+	unknown.Key = "UNKNOWN"
+	unknown.ValueRef = "keyring:token"
+	conflict.Key = "CONFLICT"
+	conflict.Value = "inline"
+	conflict.ValueRef = "env:HOME"
+	_, err := NewValueResolver().ResolveValueRefs(".gitlab-vars.json", []VarFileData{unset, unknown, conflict})
+	if err == nil {
+		t.Fatalf(`TestValueRefFailures(resolve) = nil, want an error`)
+	}
+	if err.Error() != "3 value reference(s) cannot be resolved" {
+		t.Errorf(`TestValueRefFailures(error) = %s, want %s`, err, "3 value reference(s) cannot be resolved")
+	}
+}
+
+func TestValueRefExecNotAllowed(t *testing.T) {
+	var item VarFileData
+	item.Key = "SECRET"
+	item.ValueRef = "exec:echo from-exec"
+	_, err := NewValueResolver().ResolveValueRefs(".gitlab-vars.json", []VarFileData{item})
+	if err == nil {
+		t.Errorf(`TestValueRefExecNotAllowed(resolve) = nil, want an error`)
+	}
+	var glcli GLCli
+	glcli.Config.AllowExecRefs = true
+	value, err := glcli.getResolver().Resolve(item.ValueRef)
+	if err != nil || value != "from-exec" {
+		t.Errorf(`TestValueRefExecNotAllowed(allowed) = %q, %v, want %q`, value, err, "from-exec")
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/didier13150/gitlablib"
+)
+
+const (
+	varTypeEnv  = "env_var"
+	varTypeFile = "file"
+)
+
+// VarFileData is a variable as written in var files: the gitlablib variable
+// data and the attributes which are managed by glcli itself.
+type VarFileData struct {
+	gitlablib.GitlabVarData
+	VariableType  string `json:"variable_type"`
+	ValueFromFile string `json:"value_from_file,omitempty"`
+	ValueRef      string `json:"value_ref,omitempty"`
+}
+
+func varId(key string, env string) string {
+	return key + "@" + env
+}
+
+func (data VarFileData) Type() string {
+	if data.VariableType == "" {
+		return varTypeEnv
+	}
+	return data.VariableType
+}
+
+// varFileFormat returns the format of a var file: YAML for .yaml and .yml
+// files, JSON otherwise.
+func varFileFormat(filename string) string {
+	format, err := DetectFormat(filename)
+	if err == nil && format == formatYAML {
+		return formatYAML
+	}
+	return formatJSON
+}
+
+// ImportVarFile reads a plain JSON or YAML var file as is, without resolving
+// values.
+func ImportVarFile(filename string) ([]VarFileData, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeVarFile(filename, content, varFileFormat(filename))
+}
+
+func decodeVarFile(filename string, content []byte, format string) ([]VarFileData, error) {
+	var data []VarFileData
+	var err error
+	if format == formatYAML {
+		content, err = yamlToJSON(content)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+	}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		// Decrypted SOPS files keep their vars under the variables key.
+		var wrapped map[string]json.RawMessage
+		if json.Unmarshal(content, &wrapped) == nil && wrapped[sopsVarsKey] != nil && wrapped[sopsMetadataKey] == nil {
+			err = json.Unmarshal(wrapped[sopsVarsKey], &data)
+		}
+	}
+	if err != nil {
+		tree, treeErr := parseSopsTree(content, formatJSON)
+		if treeErr == nil && IsSopsTree(tree) {
+			return nil, fmt.Errorf("%s is SOPS-encrypted", filename)
+		}
+		return nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	for _, item := range data {
+		if item.Type() != varTypeEnv && item.Type() != varTypeFile {
+			return nil, fmt.Errorf("var %s (%s) in %s has invalid variable_type %s (must be %s or %s)", item.Key, item.Env, filename, item.VariableType, varTypeEnv, varTypeFile)
+		}
+	}
+	return data, nil
+}
+
+// ExportVarFile writes var file entries to filename, sorted by key then by
+// environment scope.
+func ExportVarFile(filename string, data []VarFileData) error {
+	sorted := make([]VarFileData, len(data))
+	copy(sorted, data)
+	sortVarFileData(sorted)
+	if varFileFormat(filename) == formatYAML {
+		content, err := json.Marshal(sorted)
+		if err == nil {
+			content, err = jsonToYAML(content)
+		}
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filename, content, 0644)
+	}
+	return writeJSONFile(filename, sorted, 0644)
+}
+
+// readVarFile reads a var file, decrypting it with the age identities of the
+// key file when it is SOPS-encrypted. The age recipients of SOPS-encrypted
+// files are returned.
+func (glcli *GLCli) readVarFile(filename string) ([]VarFileData, []string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	format := varFileFormat(filename)
+	tree, err := parseSopsTree(content, format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	if !IsSopsTree(tree) {
+		data, err := decodeVarFile(filename, content, format)
+		return data, nil, err
+	}
+	if glcli.Config.VerboseMode {
+		log.Printf("Decrypt SOPS file %s", filename)
+	}
+	plain, err := SopsDecrypt(tree, glcli.getCipher().identities)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt %s: %w", filename, err)
+	}
+	vars, found := plain.Get(sopsVarsKey)
+	if !found {
+		return nil, nil, fmt.Errorf("SOPS file %s has no %s key", filename, sopsVarsKey)
+	}
+	content, err = json.Marshal(vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := decodeVarFile(filename, content, formatJSON)
+	return data, sopsRecipients(tree), err
+}
+
+// writeVarFile writes a var file, SOPS-encrypted for the given age recipients
+// and the recipients of the key file when recipients is not empty.
+func (glcli *GLCli) writeVarFile(filename string, data []VarFileData, recipients []string) error {
+	if len(recipients) == 0 {
+		return ExportVarFile(filename, data)
+	}
+	for _, recipient := range glcli.getCipher().Recipients() {
+		if !slices.Contains(recipients, recipient) {
+			recipients = append(recipients, recipient)
+		}
+	}
+	sorted := make([]VarFileData, len(data))
+	copy(sorted, data)
+	sortVarFileData(sorted)
+	content, err := json.Marshal(sorted)
+	if err != nil {
+		return err
+	}
+	vars, err := parseSopsTree(content, formatJSON)
+	if err != nil {
+		return err
+	}
+	tree, err := SopsEncrypt(sopsBranch{{Key: sopsVarsKey, Value: vars}}, recipients, time.Now())
+	if err != nil {
+		return err
+	}
+	if varFileFormat(filename) == formatYAML {
+		content, err = json.Marshal(tree)
+		if err == nil {
+			content, err = jsonToYAML(content)
+		}
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filename, content, 0644)
+	}
+	return writeJSONFile(filename, tree, 0644)
+}
+
+// valueFilePath returns the path of a value_from_file reference, relative
+// paths are relative to the var file directory.
+func valueFilePath(varfile string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(varfile), path)
+}
+
+// ResolveVarFile loads values referenced by value_from_file.
+func ResolveVarFile(varfile string, data []VarFileData) ([]VarFileData, error) {
+	resolved := make([]VarFileData, 0, len(data))
+	for _, item := range data {
+		if item.ValueFromFile != "" {
+			if item.Value != "" {
+				return nil, fmt.Errorf("var %s (%s) cannot have both value and value_from_file", item.Key, item.Env)
+			}
+			content, err := os.ReadFile(valueFilePath(varfile, item.ValueFromFile))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read value of var %s (%s): %w", item.Key, item.Env, err)
+			}
+			item.Value = string(content)
+		}
+		resolved = append(resolved, item)
+	}
+	return resolved, nil
+}
+
+func projectVarsPath(projectId string) string {
+	return "projects/" + url.PathEscape(projectId) + "/variables"
+}
+
+func groupVarsPath(groupId string) string {
+	return "groups/" + url.PathEscape(groupId) + "/variables"
+}
+
+func globalVarsPath() string {
+	return "admin/ci/variables"
+}
+
+// importVars reads a var file, resolves its values, decrypts encrypted ones
+// and resolves value references. A missing file gives no var when mandatory is false.
+func (glcli *GLCli) importVars(filename string, mandatory bool) []VarFileData {
+	data, _, err := glcli.readVarFile(filename)
+	if errors.Is(err, os.ErrNotExist) && !mandatory {
+		if glcli.Config.VerboseMode {
+			log.Printf("Cannot open %s file", filename)
+		}
+		return []VarFileData{}
+	}
+	if err != nil {
+		log.Fatalf("Cannot import var file: %s", err)
+	}
+	data, err = ResolveVarFile(filename, data)
+	if err != nil {
+		log.Fatalf("Cannot import var file: %s", err)
+	}
+	data, err = glcli.getResolver().ResolveValueRefs(filename, glcli.decryptVars(data))
+	if err != nil {
+		log.Fatalf("Cannot import var file %s: %s", filename, err)
+	}
+	return data
+}
+
+// getVarTypes returns the variable type of each var defined on Gitlab.
+func (glcli *GLCli) getVarTypes(path string) map[string]string {
+	var data []struct {
+		Key          string `json:"key"`
+		Env          string `json:"environment_scope"`
+		VariableType string `json:"variable_type"`
+	}
+	types := make(map[string]string)
+	err := glcli.client.GetAll(path, &data)
+	if err != nil {
+		log.Fatalf("Cannot fetch variable types from gitlab: %s", err)
+	}
+	for _, item := range data {
+		types[varId(item.Key, item.Env)] = item.VariableType
+	}
+	return types
+}
+
+// exportVars writes Gitlab vars in filename. Values of vars which were
+// declared with value_from_file in the previous var file are written back to
+// the referenced file, vars declared with value_ref keep their reference
+// without value, hidden vars get the placeholder value, and values of secret vars are encrypted when
+// encryption is active. The file is SOPS-encrypted when the previous file was
+// or in SOPS mode.
+func (glcli *GLCli) exportVars(filename string, vars []gitlablib.GitlabVarData, path string) {
+	types := glcli.getVarTypes(path)
+	previous := make(map[string]VarFileData)
+	olddata, recipients, err := glcli.readVarFile(filename)
+	if err == nil {
+		for _, item := range olddata {
+			previous[varId(item.Key, item.Env)] = item
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Previous var file cannot be read, it is overwritten: %s", err)
+	}
+	if glcli.Config.SopsMode && len(recipients) == 0 {
+		recipients = glcli.getCipher().Recipients()
+	}
+
+	data := make([]VarFileData, 0, len(vars))
+	for _, item := range vars {
+		entry := VarFileData{GitlabVarData: item}
+		entry.VariableType = types[varId(item.Key, item.Env)]
+		if entry.VariableType == "" {
+			entry.VariableType = varTypeEnv
+		}
+		old, found := previous[varId(item.Key, item.Env)]
+		if item.IsHidden && item.Value == "" {
+			// Gitlab does not return values of hidden vars, so references
+			// are kept and value files are not overwritten.
+			entry.Value = hiddenValue
+			if found && (old.ValueFromFile != "" || old.ValueRef != "") {
+				entry.Value = ""
+				entry.ValueFromFile = old.ValueFromFile
+				entry.ValueRef = old.ValueRef
+			}
+		} else if found && old.ValueFromFile != "" {
+			valuefile := valueFilePath(filename, old.ValueFromFile)
+			err = os.MkdirAll(filepath.Dir(valuefile), 0700)
+			if err == nil {
+				err = os.WriteFile(valuefile, []byte(item.Value), 0600)
+			}
+			if err != nil {
+				log.Fatalf("Cannot write value of var %s to %s: %s", item.Key, valuefile, err)
+			}
+			if glcli.Config.VerboseMode {
+				log.Printf("Value of var %s (%s) is written to %s", item.Key, item.Env, valuefile)
+			}
+			entry.Value = ""
+			entry.ValueFromFile = old.ValueFromFile
+		} else if found && old.ValueRef != "" {
+			entry.Value = ""
+			entry.ValueRef = old.ValueRef
+		}
+		data = append(data, entry)
+	}
+	if len(recipients) == 0 && glcli.encryptionIsActive(previous) {
+		data = glcli.encryptVars(data, previous)
+	}
+	err = glcli.writeVarFile(filename, data, recipients)
+	if err != nil {
+		log.Fatalf("Cannot export vars to %s: %s", filename, err)
+	}
+}
+
+// compareVarTypes returns the vars whose type on Gitlab differs from the var
+// file. Vars missing on Gitlab are created with the env_var type.
+func (glcli *GLCli) compareVarTypes(label string, data []VarFileData, types map[string]string) []VarFileData {
+	var toUpdate []VarFileData
+	for _, item := range data {
+		current := types[varId(item.Key, item.Env)]
+		if current == "" {
+			current = varTypeEnv
+		}
+		if current != item.Type() {
+			log.Printf("Type of %s %s (%s) should be changed from %s to %s", label, item.Key, item.Env, current, item.Type())
+			toUpdate = append(toUpdate, item)
+		}
+	}
+	return toUpdate
+}
+
+// updateVarType sets the variable type of an existing Gitlab var.
+func (glcli *GLCli) updateVarType(path string, item VarFileData, scoped bool) error {
+	body := map[string]string{
+		"value":         item.Value,
+		"variable_type": item.Type(),
+	}
+	varpath := path + "/" + url.PathEscape(item.Key)
+	if scoped {
+		varpath += "?filter[environment_scope]=" + url.QueryEscape(item.Env)
+	}
+	err := glcli.client.Request(http.MethodPut, varpath, body, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("Set type of var %s in %s env to %s", item.Key, item.Env, item.Type())
+	return nil
+}
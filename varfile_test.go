@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVarFileImportExport(t *testing.T) {
+	dir := t.TempDir()
+	varfile := filepath.Join(dir, "vars.json")
+	content := `[
+  {
+    "key": "KUBECONFIG",
+    "value": "",
+    "description": "Cluster access",
+    "environment_scope": "production",
+    "raw": true,
+    "hidden": false,
+    "protected": true,
+    "masked": false,
+    "variable_type": "file",
+    "value_from_file": "secrets/kubeconfig"
+  },
+  {
+    "key": "DEBUG_ENABLED",
+    "value": "1",
+    "description": "",
+    "environment_scope": "*",
+    "raw": true,
+    "hidden": false,
+    "protected": false,
+    "masked": false
+  }
+]`
+	err := os.WriteFile(varfile, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(write var file) = %s`, err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "secrets"), 0700)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(create secrets dir) = %s`, err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "secrets", "kubeconfig"), []byte("apiVersion: v1\n"), 0600)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(write value file) = %s`, err)
+	}
+
+	data, err := ImportVarFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(import) = %s`, err)
+	}
+	if len(data) != 2 {
+		t.Fatalf(`TestVarFileImportExport(count vars) = %d, want %d`, len(data), 2)
+	}
+	if data[0].Type() != varTypeFile {
+		t.Errorf(`TestVarFileImportExport(type of KUBECONFIG) = %s, want %s`, data[0].Type(), varTypeFile)
+	}
+	if data[1].Type() != varTypeEnv {
+		t.Errorf(`TestVarFileImportExport(default type) = %s, want %s`, data[1].Type(), varTypeEnv)
+	}
+
+	resolved, err := ResolveVarFile(varfile, data)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(resolve) = %s`, err)
+	}
+	if resolved[0].Value != "apiVersion: v1\n" {
+		t.Errorf(`TestVarFileImportExport(value from file) = %q, want %q`, resolved[0].Value, "apiVersion: v1\n")
+	}
+	if data[0].Value != "" {
+		t.Errorf(`TestVarFileImportExport(original entry is modified) = %q, want empty`, data[0].Value)
+	}
+
+	err = ExportVarFile(varfile, data)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(export) = %s`, err)
+	}
+	exported, err := ImportVarFile(varfile)
+	if err != nil {
+		t.Fatalf(`TestVarFileImportExport(import exported file) = %s`, err)
+	}
+	if exported[0].Key != "DEBUG_ENABLED" {
+		t.Errorf(`TestVarFileImportExport(first var after export) = %s, want %s`, exported[0].Key, "DEBUG_ENABLED")
+	}
+	if exported[1].ValueFromFile != "secrets/kubeconfig" {
+		t.Errorf(`TestVarFileImportExport(value_from_file after export) = %s, want %s`, exported[1].ValueFromFile, "secrets/kubeconfig")
+	}
+}
+
+func TestVarFileInvalidType(t *testing.T) {
+	varfile := filepath.Join(t.TempDir(), "vars.json")
+	err := os.WriteFile(varfile, []byte(`[{"key": "A", "value": "1", "environment_scope": "*", "variable_type": "binary"}]`), 0644)
+	if err != nil {
+		t.Fatalf(`TestVarFileInvalidType(write var file) = %s`, err)
+	}
+	_, err = ImportVarFile(varfile)
+	if err == nil {
+		t.Errorf(`TestVarFileInvalidType(import) = nil, want an error`)
+	}
+}
+
+func TestVarFileValueConflict(t *testing.T) {
+	var item VarFileData
+	item.Key = "CERT"
+	item.Value = "inline"
+	item.ValueFromFile = "cert.pem"
+	_, err := ResolveVarFile("vars.json", []VarFileData{item})
+	if err == nil {
+		t.Errorf(`TestVarFileValueConflict(resolve) = nil, want an error`)
+	}
+}
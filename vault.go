@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const refSourceVault = "vault"
+
+// VaultClient reads secrets from Vault KV version 2 secret engines.
+type VaultClient struct {
+	Addr        string
+	Token       string
+	Namespace   string
+	VerboseMode bool
+	httpClient  *http.Client
+	secrets     map[string]map[string]any
+}
+
+func NewVaultClient(addr string, token string, namespace string, verbose bool) *VaultClient {
+	client := VaultClient{}
+	client.Addr = strings.TrimSuffix(addr, "/")
+	client.Token = token
+	client.Namespace = namespace
+	client.VerboseMode = verbose
+	client.httpClient = &http.Client{Timeout: 30 * time.Second}
+	client.secrets = make(map[string]map[string]any)
+	return &client
+}
+
+// ReadField returns a field of the secret at path. The first element of the
+// path is the mount of the secret engine: secret/myapp/db is read from
+// /v1/secret/data/myapp/db. Each secret is read once.
+func (client *VaultClient) ReadField(path string, field string) (string, error) {
+	data, found := client.secrets[path]
+	if !found {
+		var err error
+		data, err = client.readSecret(path)
+		if err != nil {
+			return "", err
+		}
+		client.secrets[path] = data
+	}
+	value, found := data[field]
+	if !found {
+		return "", fmt.Errorf("secret %s has no %s field", path, field)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (client *VaultClient) readSecret(path string) (map[string]any, error) {
+	var secret struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	mount, name, found := strings.Cut(strings.Trim(path, "/"), "/")
+	if !found || name == "" {
+		return nil, fmt.Errorf("invalid secret path %s (must be <mount>/<path>)", path)
+	}
+	url := client.Addr + "/v1/" + mount + "/data/" + escapeVaultPath(name)
+	if client.VerboseMode {
+		log.Printf("Use URL %s with %s method", url, http.MethodGet)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", client.Token)
+	if client.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", client.Namespace)
+	}
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println("Cannot close response body", err)
+		}
+	}()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returns %d: %s", url, resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	err = json.Unmarshal(content, &secret)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode response of GET %s: %w", url, err)
+	}
+	if secret.Data.Data == nil {
+		return nil, fmt.Errorf("secret %s is deleted", path)
+	}
+	return secret.Data.Data, nil
+}
+
+func escapeVaultPath(path string) string {
+	parts := strings.Split(path, "/")
+	for idx, part := range parts {
+		parts[idx] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// getVaultToken returns the VAULT_TOKEN environment variable or the content of
+// the Vault token file.
+func (glcli *GLCli) getVaultToken() (string, error) {
+	if len(os.Getenv("VAULT_TOKEN")) > 0 {
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+	_, err := os.Stat(glcli.Config.VaultTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("no VAULT_TOKEN environment variable and %w", err)
+	}
+	glcli.checkSecretFile(glcli.Config.VaultTokenFile)
+	content, err := os.ReadFile(glcli.Config.VaultTokenFile)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("vault token file %s is empty", glcli.Config.VaultTokenFile)
+	}
+	return token, nil
+}
+
+// readVaultSource resolves vault:path#field references. The Vault client is
+// created at the first reference.
+func (glcli *GLCli) readVaultSource(argument string) (string, error) {
+	path, field, found := strings.Cut(argument, "#")
+	if !found || path == "" || field == "" {
+		return "", errors.New("vault reference must be vault:<path>#<field>")
+	}
+	if glcli.vault == nil {
+		token, err := glcli.getVaultToken()
+		if err != nil {
+			return "", err
+		}
+		if glcli.Config.VerboseMode {
+			log.Printf("Get secrets from Vault %s", glcli.Config.VaultAddr)
+		}
+		glcli.vault = NewVaultClient(glcli.Config.VaultAddr, token, glcli.Config.VaultNamespace, glcli.Config.VerboseMode)
+	}
+	return glcli.vault.ReadField(path, field)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestVaultServer(t *testing.T, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get("X-Vault-Token") != "s.test" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/myapp/db" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"password":"p4ss","port":5432},"metadata":{"version":3}}}`))
+	}))
+}
+
+func TestVaultValueRef(t *testing.T) {
+	requests := 0
+	server := newTestVaultServer(t, &requests)
+	defer server.Close()
+	var glcli GLCli
+	glcli.Config.VaultAddr = server.URL
+	glcli.Config.VaultNamespace = "team"
+	glcli.Config.VaultTokenFile = filepath.Join(t.TempDir(), "vault-token")
+	err := os.WriteFile(glcli.Config.VaultTokenFile, []byte("s.test\n"), 0600)
+	if err != nil {
+		t.Fatalf(`TestVaultValueRef(write token file) = %s`, err)
+	}
+	t.Setenv("VAULT_TOKEN", "")
+
+	var password, port VarFileData
+	password.Key = "DB_PASSWORD"
+	password.ValueRef = "vault:secret/myapp/db#password"
+	port.Key = "DB_PORT"
+	port.ValueRef = "vault:secret/myapp/db#port"
+	data, err := glcli.getResolver().ResolveValueRefs(".gitlab-vars.json", []VarFileData{password, port})
+	if err != nil {
+		t.Fatalf(`TestVaultValueRef(resolve) = %s`, err)
+	}
+	if data[0].Value != "p4ss" {
+		t.Errorf(`TestVaultValueRef(password) = %s, want %s`, data[0].Value, "p4ss")
+	}
+	if data[1].Value != "5432" {
+		t.Errorf(`TestVaultValueRef(port) = %s, want %s`, data[1].Value, "5432")
+	}
+	if requests != 1 {
+		t.Errorf(`TestVaultValueRef(count requests) = %d, want %d`, requests, 1)
+	}
+
+	var missing VarFileData
+	missing.Key = "MISSING"
+	missing.ValueRef = "vault:secret/myapp/other#password"
+	_, err = glcli.getResolver().ResolveValueRefs(".gitlab-vars.json", []VarFileData{missing})
+	if err == nil {
+		t.Errorf(`TestVaultValueRef(missing secret) = nil, want an error`)
+	}
+}
+
+func TestVaultToken(t *testing.T) {
+	var glcli GLCli
+	glcli.Config.VaultTokenFile = filepath.Join(t.TempDir(), "missing")
+	t.Setenv("VAULT_TOKEN", "s.env")
+	token, err := glcli.getVaultToken()
+	if err != nil || token != "s.env" {
+		t.Errorf(`TestVaultToken(from env) = %s, %v, want %s`, token, err, "s.env")
+	}
+	t.Setenv("VAULT_TOKEN", "")
+	_, err = glcli.getVaultToken()
+	if err == nil {
+		t.Errorf(`TestVaultToken(missing token file) = nil, want an error`)
+	}
+}